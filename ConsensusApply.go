@@ -0,0 +1,278 @@
+package raft
+
+import (
+	"context"
+	"maps"
+	"time"
+)
+
+// applyLoop delivers committed commands on ReceiveChan in log order,
+// advancing LastApplied and waking anyone waiting on c.applied as each one is
+// handed off, until ctx is cancelled. Retries of an applied client request are
+// skipped. A snapshot restored from storage, or one
+// installed past LastApplied, is delivered first, unless Config.AppliedIndex
+// says the application already has it. With an FSM everything goes to it
+// instead, and Apply's results to the ProposeApply calls waiting for them.
+// With Config.ApplyBatchSize above one, commands are handed off in batches.
+func (c *ConsensusModule[j, x, k]) applyLoop(ctx context.Context) {
+	c.Mutex.Lock()
+	restored := c.snapshotMsg()
+	c.Mutex.Unlock()
+	if restored.Index > c.Config.AppliedIndex {
+		if _, ok := c.handOff(ctx, []ApplyMsg[j]{restored}); !ok {
+			return
+		}
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-c.applyNotify:
+		}
+		for {
+			c.Mutex.Lock()
+			batch, through, ok := c.nextBatch()
+			if !ok {
+				c.Mutex.Unlock()
+				break
+			}
+			if len(batch) == 0 {
+				c.LastApplied = through
+				c.applied.Broadcast()
+				c.Mutex.Unlock()
+				continue
+			}
+			c.Mutex.Unlock()
+			values, ok := c.handOff(ctx, batch)
+			if !ok {
+				return
+			}
+			c.Mutex.Lock()
+			for i, message := range batch {
+				if message.SnapshotValid {
+					c.sessions = maps.Clone(c.snapshotSessions)
+					continue
+				}
+				var value any
+				if i < len(values) {
+					value = values[i]
+				}
+				c.recordSession(message, value)
+				if result, ok := c.results[message.Index]; ok && result.term == message.Term {
+					result.value = value
+				}
+			}
+			c.LastApplied = max(c.LastApplied, through)
+			c.applied.Broadcast()
+			c.Mutex.Unlock()
+			c.maybeSnapshot()
+		}
+	}
+}
+
+// nextBatch collects what the apply loop hands off next, through the index
+// it ends at. That is the snapshot when LastApplied is behind it, or else a
+// run of up to Config.ApplyBatchSize committed commands after LastApplied. A
+// no-op, configuration entry or retry there comes back alone with an empty
+// batch to be skipped, and ends any run before it, as does a second request
+// from one client, which may turn out to be a retry once the first is
+// applied. It reports false once everything committed has been applied. It
+// expects c.Mutex to be held.
+func (c *ConsensusModule[j, x, k]) nextBatch() (batch []ApplyMsg[j], through Index, ok bool) {
+	if c.LastApplied >= c.CommitIndex {
+		return nil, 0, false
+	}
+	if c.LastApplied < c.LastIncludedIndex {
+		return []ApplyMsg[j]{c.snapshotMsg()}, c.LastIncludedIndex, true
+	}
+	size := max(c.Config.ApplyBatchSize, 1)
+	clients := make(map[uint]bool)
+	for through = c.LastApplied; through < c.CommitIndex && len(batch) < size; through++ {
+		entry, _ := c.entryAt(through + 1)
+		if entry.Type != CommandEntry || duplicate(c.sessions, entry) {
+			if len(batch) == 0 {
+				through++
+			}
+			break
+		}
+		if entry.ClientId != 0 {
+			if clients[entry.ClientId] {
+				break
+			}
+			clients[entry.ClientId] = true
+		}
+		batch = append(batch, ApplyMsg[j]{
+			Command:  entry.Command,
+			Index:    through + 1,
+			Term:     entry.Term,
+			ClientId: entry.ClientId,
+			Seq:      entry.Seq,
+		})
+	}
+	return batch, through, true
+}
+
+// snapshotMsg is the ApplyMsg that delivers our snapshot. It expects c.Mutex
+// to be held.
+func (c *ConsensusModule[j, x, k]) snapshotMsg() ApplyMsg[j] {
+	return ApplyMsg[j]{
+		SnapshotValid: true,
+		Snapshot:      c.snapshot,
+		Index:         c.LastIncludedIndex,
+		Term:          c.LastIncludedTerm,
+	}
+}
+
+// skipApplied moves LastApplied, and CommitIndex with it, up to index, which
+// the application reports having applied before a restart. An index behind
+// the restored snapshot changes nothing, and one past the end of the log is
+// taken to mean all of it.
+func (c *ConsensusModule[j, x, k]) skipApplied(index Index) {
+	lastIndex, _ := c.lastLog()
+	index = min(index, lastIndex)
+	if index <= c.LastApplied {
+		return
+	}
+	c.setCommitIndex(index)
+	c.LastApplied = index
+	c.sessions = c.sessionsAt(index)
+}
+
+// deliver hands batch to the application, whole on ApplyBatchChan when
+// Config.ApplyBatchSize is above one and otherwise as its only message on
+// ReceiveChan, reporting false if ctx is done first. A slow consumer only
+// holds up the apply loop: LastApplied falls behind, and reads waiting on it
+// with it, while replication, commitment and heartbeats carry on. With
+// Config.ApplyTimeout set, a warning is logged every time a batch has waited
+// that long.
+func (c *ConsensusModule[j, x, k]) deliver(ctx context.Context, batch []ApplyMsg[j]) bool {
+	var single chan<- ApplyMsg[j]
+	var batched chan<- []ApplyMsg[j]
+	if c.Config.ApplyBatchSize > 1 {
+		batched = c.ApplyBatchChan
+	} else {
+		single = c.ReceiveChan
+	}
+	var slow <-chan time.Time
+	if c.Config.ApplyTimeout > 0 {
+		ticker := c.Config.Clock.NewTicker(c.Config.ApplyTimeout)
+		defer ticker.Stop()
+		slow = ticker.C()
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return false
+		case single <- batch[0]:
+			return true
+		case batched <- batch:
+			return true
+		case <-slow:
+			c.Mutex.Lock()
+			c.warn("apply channel is full", "index", batch[0].Index)
+			c.Mutex.Unlock()
+		}
+	}
+}
+
+// notifyApply wakes the apply loop without blocking.
+func (c *ConsensusModule[j, x, k]) notifyApply() {
+	select {
+	case c.applyNotify <- struct{}{}:
+	default:
+	}
+}
+
+// WaitForApply blocks until the entry at index has been applied or ctx is
+// done. It returns ErrOverwritten if the entry held at index when it was
+// called was replaced by one from another term before being applied, as
+// happens to proposals from a leader that lost its term.
+func (c *ConsensusModule[j, x, k]) WaitForApply(ctx context.Context, index Index) error {
+	c.Mutex.Lock()
+	defer c.Mutex.Unlock()
+	entry, _ := c.entryAt(index)
+	return c.waitForApply(ctx, index, entry.Term)
+}
+
+// ProposeWait is Propose for a caller that wants the outcome: it waits until
+// the entry has been committed and applied, or ctx is done. It fails with
+// ErrNotLeader where Propose reports isLeader false and with ErrOverwritten
+// if a later leader replaced the entry. Giving up on ctx does not withdraw
+// the entry, which may still commit afterwards, so its index and term are
+// returned with ctx's error for a later WaitForApply to settle.
+func (c *ConsensusModule[j, x, k]) ProposeWait(ctx context.Context, command j) (Index, Term, error) {
+	peers := c.peerIds()
+	c.Mutex.Lock()
+	defer c.Mutex.Unlock()
+	index, term, isLeader := c.propose(peers, LogEntry[j]{Command: command})
+	if !isLeader {
+		return 0, term, c.notLeader()
+	}
+	return index, term, c.waitForApply(ctx, index, term)
+}
+
+// waitForApply blocks until index has been applied, then reports
+// ErrOverwritten if the entry there is not from term. A zero term is not
+// checked. It expects c.Mutex to be held and releases it while waiting.
+func (c *ConsensusModule[j, x, k]) waitForApply(ctx context.Context, index Index, term Term) error {
+	stop := context.AfterFunc(ctx, func() {
+		c.Mutex.Lock()
+		defer c.Mutex.Unlock()
+		c.applied.Broadcast()
+	})
+	defer stop()
+	for c.LastApplied < index {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if c.closed {
+			return ErrClosed
+		}
+		c.applied.Wait()
+	}
+	if current, ok := c.entryAt(index); term != 0 && ok && current.Term != term {
+		return ErrOverwritten
+	}
+	return nil
+}
+
+// Barrier appends a no-op entry and waits for it to be applied, by which time
+// every entry proposed before it has been applied too. It fails with
+// ErrOverwritten as soon as a later leader replaces the entry, with
+// ErrNotLeader if we are not leader, or stop being leader while the entry is
+// still ours but uncommitted, and with ctx's error if ctx is done first.
+func (c *ConsensusModule[j, x, k]) Barrier(ctx context.Context) error {
+	peers := c.peerIds()
+	stop := context.AfterFunc(ctx, func() {
+		c.Mutex.Lock()
+		defer c.Mutex.Unlock()
+		c.applied.Broadcast()
+	})
+	defer stop()
+	c.Mutex.Lock()
+	defer c.Mutex.Unlock()
+	index, term, isLeader := c.propose(peers, LogEntry[j]{Type: NoOpEntry})
+	if !isLeader {
+		return c.notLeader()
+	}
+	for c.LastApplied < index {
+		if c.termAt(index) != term {
+			return ErrOverwritten
+		}
+		deposed := c.State != Leader || c.CurrentTerm != term
+		if deposed && c.CommitIndex < index {
+			return c.notLeader()
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if c.closed {
+			return ErrClosed
+		}
+		c.applied.Wait()
+	}
+	if entry, ok := c.entryAt(index); ok && entry.Term != term {
+		return ErrOverwritten
+	}
+	return nil
+}
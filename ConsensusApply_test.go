@@ -0,0 +1,295 @@
+package raft
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReceiveChanDeliversCommitted(t *testing.T) {
+	modules, _ := startCluster(t, 3)
+	leader := waitLeader(t, modules)
+	if _, _, ok := leader.Propose("SET 1"); !ok {
+		t.Fatal("leader refused the proposal")
+	}
+	for _, module := range modules {
+		if msg := receive(t, module); msg.Command != "SET 1" {
+			t.Errorf("node %d delivered %q, want SET 1", module.Id, msg.Command)
+		}
+	}
+}
+
+func TestWaitForApply(t *testing.T) {
+	modules, _ := startCluster(t, 3)
+	leader := waitLeader(t, modules)
+	index, _, ok := leader.Propose("SET 1")
+	if !ok {
+		t.Fatal("leader refused the proposal")
+	}
+	for _, module := range modules {
+		ctx, cancel := context.WithTimeout(context.Background(), waitTimeout)
+		err := module.WaitForApply(ctx, index)
+		cancel()
+		if err != nil {
+			t.Fatalf("node %d: WaitForApply = %v", module.Id, err)
+		}
+		module.Mutex.Lock()
+		applied := module.LastApplied
+		module.Mutex.Unlock()
+		if applied < index {
+			t.Errorf("node %d returned from WaitForApply at %d, before applying %d", module.Id, applied, index)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := leader.WaitForApply(ctx, index+10); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("WaitForApply on an index never proposed = %v, want the deadline", err)
+	}
+}
+
+func TestApplyMsgMatchesEntry(t *testing.T) {
+	modules, _ := startCluster(t, 3)
+	leader := waitLeader(t, modules)
+	index, term, ok := leader.Propose("SET 1")
+	if !ok {
+		t.Fatal("leader refused the proposal")
+	}
+	want := ApplyMsg[string]{Command: "SET 1", Index: index, Term: term}
+	for _, module := range modules {
+		if msg := receive(t, module); msg.Command != want.Command || msg.Index != want.Index || msg.Term != want.Term || msg.SnapshotValid {
+			t.Errorf("node %d delivered %+v, want %+v", module.Id, msg, want)
+		}
+	}
+}
+
+func TestLoneNodeApplies(t *testing.T) {
+	contact := new(fakeContact)
+	module, err := NewConsensusModule[string, int, bool](1, contact, NewMemoryStorage[string]())
+	if err != nil {
+		t.Fatal(err)
+	}
+	start(t, module)
+	waitLeader(t, []*testModule{module})
+	for _, command := range []string{"SET a 1", "SET b 2", "SET c 3"} {
+		index, _, ok := module.Propose(command)
+		if !ok {
+			t.Fatalf("lone node refused %q", command)
+		}
+		if msg := receive(t, module); msg.Command != command || msg.Index != index {
+			t.Errorf("applied %q at %d, want %q at %d", msg.Command, msg.Index, command, index)
+		}
+	}
+	if rpcs := contact.rpcs.Load(); rpcs != 0 {
+		t.Errorf("lone node made %d RPCs", rpcs)
+	}
+}
+
+func TestSlowConsumerKeepsHeartbeats(t *testing.T) {
+	logger := new(captureLogger)
+	modules, _ := startCluster(t, 3, WithBufferSize(1), WithApplyTimeout(20*time.Millisecond), WithLogger(logger))
+	leader := waitLeader(t, modules)
+	term, _, _ := leader.GetState()
+	// Nothing reads ReceiveChan, so every apply loop is stuck after the
+	// first entry while the rest keep committing.
+	var index Index
+	for i := 0; i < 20; i++ {
+		index, _, _ = leader.Propose(fmt.Sprintf("SET k %d", i))
+	}
+	waitCommitted(t, modules, index)
+	// Well past the longest election timeout: had heartbeats stopped, a
+	// follower would have stood for election.
+	time.Sleep(time.Second)
+	for _, module := range modules {
+		if current, _, _ := module.GetState(); current != term {
+			t.Errorf("node %d moved from term %d to %d behind a slow consumer", module.Id, term, current)
+		}
+	}
+	logger.mutex.Lock()
+	warned := slices.ContainsFunc(logger.lines, func(line string) bool {
+		return strings.HasPrefix(line, "WARN apply channel is full")
+	})
+	logger.mutex.Unlock()
+	if !warned {
+		t.Error("no warning about the full apply channel")
+	}
+
+	drain(modules...)
+	waitFor(t, "every entry to be applied", func() bool {
+		for _, module := range modules {
+			module.Mutex.Lock()
+			applied := module.LastApplied
+			module.Mutex.Unlock()
+			if applied < index {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+func TestBarrierWaitsForPriorProposals(t *testing.T) {
+	modules, network := startCluster(t, 3, quiet, WithPreVote(false))
+	leader := modules[0]
+	leader.ForceElection()
+	var want []string
+	for i := 0; i < 5; i++ {
+		command := fmt.Sprintf("SET k %d", i)
+		leader.Propose(command)
+		want = append(want, command)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), waitTimeout)
+	defer cancel()
+	if err := leader.Barrier(ctx); err != nil {
+		t.Fatalf("Barrier = %v", err)
+	}
+	// Everything proposed before the barrier is waiting on ReceiveChan by now.
+	var got []string
+	for len(got) < len(want) {
+		select {
+		case msg := <-leader.ReceiveChan:
+			got = append(got, msg.Command)
+		default:
+			t.Fatalf("Barrier returned with only %v applied, want %v", got, want)
+		}
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("applied %v, want %v", got, want)
+	}
+
+	// Cut off, the leader cannot commit a barrier. It learns it was deposed
+	// from the new leader's entries, which replace the barrier, and not from
+	// a reply to its own heartbeats, which stay cut off.
+	network.Partition([][]uint{{1}, {2, 3}})
+	last := leader.LastLogIndex()
+	failed := make(chan error, 1)
+	go func() { failed <- leader.Barrier(ctx) }()
+	waitFor(t, "the barrier to be appended", func() bool {
+		return leader.LastLogIndex() > last
+	})
+	modules[1].ForceElection()
+	network.Heal()
+	network.SetDropped(1, 2, true)
+	network.SetDropped(1, 3, true)
+	modules[1].handleLeader()
+	select {
+	case err := <-failed:
+		if !errors.Is(err, ErrOverwritten) {
+			t.Errorf("Barrier on a deposed leader = %v, want ErrOverwritten", err)
+		}
+	case <-time.After(waitTimeout):
+		t.Fatal("Barrier on a deposed leader never returned")
+	}
+}
+
+func TestProposeWaitDeadline(t *testing.T) {
+	modules, network := startCluster(t, 3, quiet)
+	drain(modules[1:]...)
+	leader := modules[0]
+	leader.ForceElection()
+	waitCommitted(t, modules, 2)
+	network.Partition([][]uint{{1}, {2, 3}})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	index, _, err := leader.ProposeWait(ctx, "SET a 1")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("ProposeWait on a stalled cluster = %v, want the deadline", err)
+	}
+	if index == 0 {
+		t.Fatal("ProposeWait gave no index to follow the entry up with")
+	}
+
+	// The entry stays in the leader's log and commits once the cluster
+	// recovers.
+	network.Heal()
+	ctx, cancel = context.WithTimeout(context.Background(), waitTimeout)
+	defer cancel()
+	if err := leader.WaitForApply(ctx, index); err != nil {
+		t.Fatalf("WaitForApply(%d) after healing = %v", index, err)
+	}
+	if entry, err := leader.Get(index); err != nil || entry.Command != "SET a 1" {
+		t.Errorf("Get(%d) = %v, %v; want the proposal", index, entry, err)
+	}
+}
+
+func TestRestartDoesNotReapply(t *testing.T) {
+	for name, open := range storageKinds() {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			applied := make(map[Index]string)
+			run := func(options ...Option) {
+				module, err := NewInMemoryNetwork[string, int, bool]().Add(1, open(t, dir), options...)
+				if err != nil {
+					t.Fatal(err)
+				}
+				start(t, module)
+				waitLeader(t, []*testModule{module})
+				ctx, cancel := context.WithTimeout(context.Background(), waitTimeout)
+				defer cancel()
+				var last Index
+				for i := 0; i < 3; i++ {
+					if last, _, err = module.ProposeWait(ctx, fmt.Sprintf("SET k %d", len(applied)+i)); err != nil {
+						t.Fatal(err)
+					}
+				}
+				module.Close()
+				for msg := range module.ReceiveChan {
+					if previous, ok := applied[msg.Index]; ok {
+						t.Errorf("index %d applied again as %q, first as %q", msg.Index, msg.Command, previous)
+					}
+					applied[msg.Index] = msg.Command
+				}
+				if _, ok := applied[last]; !ok {
+					t.Fatalf("the entry at %d was never applied", last)
+				}
+			}
+			run()
+			var through Index
+			for index := range applied {
+				through = max(through, index)
+			}
+			run(WithAppliedIndex(through))
+		})
+	}
+}
+
+func TestCommitFollowsMajority(t *testing.T) {
+	modules, network := newCluster(t, 5, quiet)
+	leader := modules[0]
+	leader.ForceElection()
+	leader.handleLeader()
+	network.Partition([][]uint{{1, 2}, {3, 4, 5}})
+	index, _, ok := leader.Propose("SET 1")
+	if !ok {
+		t.Fatal("leader refused the proposal")
+	}
+	leader.handleLeader()
+	if commit := leader.GetCommitIndex(); commit >= index {
+		t.Fatalf("commit index %d with the entry on two of five nodes, want below %d", commit, index)
+	}
+	network.Partition([][]uint{{1, 2, 3}, {4, 5}})
+	leader.handleLeader()
+	if commit := leader.GetCommitIndex(); commit != index {
+		t.Fatalf("commit index %d with the entry on three of five nodes, want %d", commit, index)
+	}
+
+	// A follower commits no further than the entries it was sent, however far
+	// the leader has got.
+	follower := modules[4]
+	term, _, _ := leader.GetState()
+	follower.AppendEntry(AppendEntries[string]{Term: term, LeaderId: 1, PrevLogIndex: 1, LeaderCommit: index,
+		Entries: []LogEntry[string]{{Term: term, Type: NoOpEntry}}})
+	if commit := follower.GetCommitIndex(); commit != 2 {
+		t.Errorf("follower commit index %d, want 2", commit)
+	}
+
+	start(t, leader)
+	if msg := receive(t, leader); msg.Index != index || msg.Command != "SET 1" {
+		t.Errorf("delivered %+v, want SET 1 at %d", msg, index)
+	}
+}
@@ -1,37 +1,126 @@
 package raft
 
-func (c *ConsensusModule[j, k, x]) handleCandidate() {
-	var serverRequestVote RequestVote[j]
-	if len(c.Log) == 0 {
-		serverRequestVote = c.NewRequestVote(true)
-	} else {
-		serverRequestVote = c.NewRequestVote(false)
+import "slices"
+
+// startElection runs an election once Pre-Vote, when enabled, shows it could
+// be won.
+func (c *ConsensusModule[j, k, x]) startElection() {
+	c.Mutex.Lock()
+	member := c.isMember()
+	c.Mutex.Unlock()
+	if !member {
+		return
+	}
+	if c.Config.PreVote && len(c.peerIds()) > 0 && !c.preVote() {
+		return
+	}
+	c.runElection(false)
+}
+
+// runElection moves the node into a new term as a candidate, votes for itself
+// and asks every peer for a vote, becoming leader on a majority of the voting
+// peers plus itself. Votes from servers outside that set are not counted.
+// The term, the vote for ourselves and the move to candidate are made in one
+// critical section and persisted before any RPC goes out, so a RequestVote
+// arriving meanwhile finds the vote in the new term already cast. transfer
+// marks the election TimeoutNow asked for.
+func (c *ConsensusModule[j, k, x]) runElection(transfer bool) {
+	c.Mutex.Lock()
+	c.State = Candidate
+	c.CurrentTerm++
+	c.VotedFor = int(c.Id)
+	c.LeaderId = 0
+	c.setTicker()
+	if c.persistState() != nil {
+		c.State = Follower
+		c.Mutex.Unlock()
+		return
+	}
+	term := c.CurrentTerm
+	c.info("starting election")
+	c.emit(func(m Metrics) { m.TermChanged(term) })
+	c.emit(func(m Metrics) { m.ElectionStarted(term) })
+	serverRequestVote := c.NewRequestVote()
+	serverRequestVote.LeadershipTransfer = transfer
+	c.Mutex.Unlock()
+	peers := c.peerIds()
+	var votes map[uint]Reply
+	if len(peers) > 0 {
+		ctx, cancel := c.rpcContext(c.Config.HeartbeatIntervalMax)
+		votes = c.Contact.RequestVotes(ctx, serverRequestVote)
+		cancel()
+	}
+	c.Mutex.Lock()
+	defer c.Mutex.Unlock()
+	if c.State != Candidate || c.CurrentTerm != serverRequestVote.Term {
+		c.emit(func(m Metrics) { m.ElectionLost(term) })
+		return
 	}
-	votes := c.Contact.RequestVotes(serverRequestVote)
-	var vc int
-	for _, vote := range votes {
-		if vote.VoteGranted {
+	vc := 1
+	for peer, vote := range votes {
+		if vote.Term > c.CurrentTerm {
+			c.becomeFollower(vote.Term)
+			c.emit(func(m Metrics) { m.ElectionLost(term) })
+			return
+		}
+		if vote.VoteGranted && slices.Contains(peers, peer) {
 			vc++
 		}
 	}
-	if vc > len(votes)/2 {
-		c.State = Leader
-		c.SetTicker()
+	if vc >= quorum(peers) {
+		c.becomeLeader(peers)
+		c.emit(func(m Metrics) { m.ElectionWon(term) })
+	} else {
+		c.emit(func(m Metrics) { m.ElectionLost(term) })
 	}
 }
 
-func (c *ConsensusModule[j, k, x]) validCandidate() bool {
-	var request RequestVote[j]
-	if len(c.Log) == 0 {
-		request = c.NewRequestVote(true)
-	} else {
-		request = c.NewRequestVote(false)
+// preVote asks the peers whether they would vote for us in the next term
+// without changing anyone's term, reporting whether a majority would.
+func (c *ConsensusModule[j, k, x]) preVote() bool {
+	c.Mutex.Lock()
+	serverRequestVote := c.NewRequestVote()
+	serverRequestVote.Term++
+	serverRequestVote.PreVote = true
+	c.setTicker()
+	c.Mutex.Unlock()
+	peers := c.peerIds()
+	ctx, cancel := c.rpcContext(c.Config.HeartbeatIntervalMax)
+	votes := c.Contact.RequestVotes(ctx, serverRequestVote)
+	cancel()
+	c.Mutex.Lock()
+	defer c.Mutex.Unlock()
+	if c.State == Leader || c.CurrentTerm+1 != serverRequestVote.Term {
+		return false
 	}
-	if c.VotedFor == -1 && request.Term >= c.CurrentTerm {
-		nodeLastLogLen, nodeLastLogTerm := c.lastLog()
-		if (request.LastLogIndex == nodeLastLogLen && nodeLastLogTerm == request.LastLogTerm) || request.LastLogIndex > nodeLastLogLen {
-			return true
+	vc := 1
+	for peer, vote := range votes {
+		if vote.Term > c.CurrentTerm {
+			c.becomeFollower(vote.Term)
+			return false
+		}
+		if vote.VoteGranted && slices.Contains(peers, peer) {
+			vc++
 		}
 	}
-	return false
+	return vc >= quorum(peers)
+}
+
+// grantPreVote reports whether we would vote for the candidate in its next
+// term: its log must be up to date and we must not have heard from a leader
+// within the minimum election timeout. It expects c.Mutex to be held.
+func (c *ConsensusModule[j, k, x]) grantPreVote(request RequestVote[j]) bool {
+	if c.State == Leader || request.Term <= c.CurrentTerm {
+		return false
+	}
+	if c.leaderActive() {
+		return false
+	}
+	return c.logUpToDate(request.LastLogIndex, request.LastLogTerm)
+}
+
+// leaderActive reports whether we have heard from a leader within the
+// minimum election timeout. It expects c.Mutex to be held.
+func (c *ConsensusModule[j, k, x]) leaderActive() bool {
+	return c.Config.Clock.Now().Sub(c.leaderContact) < c.Config.ElectionTimeoutMin
 }
@@ -0,0 +1,241 @@
+package raft
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// quiet keeps the election timeout from ever firing during a test, so that
+// only ForceElection starts elections.
+var quiet = WithElectionTimeout(time.Hour, time.Hour)
+
+func TestForceElection(t *testing.T) {
+	modules, _ := startCluster(t, 3, quiet)
+	modules[1].ForceElection()
+	for _, module := range modules {
+		term, isLeader, _ := module.GetState()
+		if isLeader != (module == modules[1]) || term != 1 {
+			t.Errorf("node %d: term %d, leader %v; want node 2 elected in term 1", module.Id, term, isLeader)
+		}
+	}
+
+	modules[1].ForceElection()
+	if term, isLeader, _ := modules[1].GetState(); !isLeader || term != 1 {
+		t.Errorf("leader forced into an election: term %d, leader %v", term, isLeader)
+	}
+}
+
+// fakeContact is a Contact whose peers answer RequestVote with the replies
+// in votes and never answer anything else. With stall set, RequestVotes
+// returns only once ctx is done, as it would with a peer left out of votes
+// that never answers. rpcs counts the calls to the RPC methods.
+type fakeContact struct {
+	peers []uint
+	votes map[uint]Reply
+	stall bool
+	rpcs  atomic.Int32
+}
+
+func (f *fakeContact) GetPeerIds() []uint { return f.peers }
+
+func (f *fakeContact) RequestVotes(ctx context.Context, vote RequestVote[string]) map[uint]Reply {
+	f.rpcs.Add(1)
+	if f.stall {
+		<-ctx.Done()
+	}
+	return f.votes
+}
+
+func (f *fakeContact) AppendEntries(ctx context.Context, entries map[uint]AppendEntries[string]) map[uint]Reply {
+	f.rpcs.Add(1)
+	return nil
+}
+
+func (f *fakeContact) InstallSnapshot(ctx context.Context, peer uint, snapshot InstallSnapshot) Reply {
+	f.rpcs.Add(1)
+	return Reply{}
+}
+
+func (f *fakeContact) GetLeader() uint                  { return 0 }
+func (f *fakeContact) GetLeaderLog() []LogEntry[string] { return nil }
+func (f *fakeContact) ValidLogEntryCommand(string) bool { return true }
+func (f *fakeContact) ValidLog([]LogEntry[string]) bool { return true }
+func (f *fakeContact) ExecuteLog(uint, []string) error  { return nil }
+func (f *fakeContact) DefaultLogEntryCommand() string   { return "" }
+func (f *fakeContact) LogValue([]LogEntry[string]) int  { return 0 }
+
+func TestElectionCountsMajority(t *testing.T) {
+	tests := map[string]struct {
+		votes  map[uint]Reply
+		leader bool
+		term   Term
+	}{
+		"two of three granting": {
+			votes:  map[uint]Reply{2: {Term: 1, VoteGranted: true}, 3: {Term: 1, VoteGranted: true}, 4: {Term: 1}},
+			leader: true,
+			term:   1,
+		},
+		"one of three granting": {
+			votes: map[uint]Reply{2: {Term: 1, VoteGranted: true}, 3: {Term: 1}, 4: {Term: 1}},
+			term:  1,
+		},
+		"a higher term": {
+			votes: map[uint]Reply{2: {Term: 1, VoteGranted: true}, 3: {Term: 1, VoteGranted: true}, 4: {Term: 3}},
+			term:  3,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			contact := &fakeContact{peers: []uint{2, 3, 4}, votes: test.votes}
+			module, err := NewConsensusModule[string, int, bool](1, contact, NewMemoryStorage[string](), quiet, WithPreVote(false))
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(module.Close)
+			module.startElection()
+			term, isLeader, _ := module.GetState()
+			if isLeader != test.leader || term != test.term {
+				t.Errorf("term %d, leader %v; want term %d, leader %v", term, isLeader, test.term, test.leader)
+			}
+		})
+	}
+}
+
+// tickerDuration returns the tick module last picked.
+func tickerDuration(module *testModule) time.Duration {
+	module.Mutex.Lock()
+	defer module.Mutex.Unlock()
+	return module.TickerDuration
+}
+
+func TestWinnerTicksAtHeartbeatInterval(t *testing.T) {
+	modules, _ := startCluster(t, 3, quiet)
+	if tick := tickerDuration(modules[0]); tick != time.Hour {
+		t.Fatalf("follower ticks every %v, want the election timeout", tick)
+	}
+	modules[0].ForceElection()
+	if _, isLeader, _ := modules[0].GetState(); !isLeader {
+		t.Fatal("node 1 was not elected")
+	}
+	if tick := tickerDuration(modules[0]); tick < 50*time.Millisecond || tick >= 200*time.Millisecond {
+		t.Errorf("leader ticks every %v, want between 50ms and 200ms", tick)
+	}
+}
+
+func TestPreVoteRejoinDoesNotDisrupt(t *testing.T) {
+	modules, network := startCluster(t, 3)
+	leader := waitLeader(t, modules)
+	term, _, _ := leader.GetState()
+	var isolated *testModule
+	var rest []uint
+	for _, module := range modules {
+		if module != leader && isolated == nil {
+			isolated = module
+		} else {
+			rest = append(rest, module.Id)
+		}
+	}
+
+	network.Partition([][]uint{{isolated.Id}, rest})
+	// Long enough for several election timeouts, none of which may move the
+	// isolated node into a new term since no one answers its Pre-Votes.
+	time.Sleep(1500 * time.Millisecond)
+	if isolatedTerm, _, _ := isolated.GetState(); isolatedTerm != term {
+		t.Errorf("isolated node moved to term %d from %d", isolatedTerm, term)
+	}
+	network.Heal()
+	time.Sleep(time.Second)
+	if current, isLeader, _ := leader.GetState(); !isLeader || current != term {
+		t.Errorf("leader of term %d is now in term %d, leader %v", term, current, isLeader)
+	}
+}
+
+func TestElectionWithStalledPeer(t *testing.T) {
+	contact := &fakeContact{
+		peers: []uint{2, 3, 4},
+		votes: map[uint]Reply{2: {Term: 1, VoteGranted: true}, 3: {Term: 1, VoteGranted: true}},
+		stall: true,
+	}
+	module, err := NewConsensusModule[string, int, bool](1, contact, NewMemoryStorage[string](), quiet, WithPreVote(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(module.Close)
+	started := time.Now()
+	module.startElection()
+	// Node 4 never answers; the election gives up on it after the RPC
+	// deadline, HeartbeatIntervalMax, and wins on the other two votes.
+	if elapsed := time.Since(started); elapsed > time.Second {
+		t.Errorf("election took %v with a stalled peer", elapsed)
+	}
+	if _, isLeader, _ := module.GetState(); !isLeader {
+		t.Error("not elected on the votes that did arrive")
+	}
+}
+
+func TestSplitVoteRetried(t *testing.T) {
+	modules, network := newCluster(t, 4, WithPreVote(false))
+	// Each candidate reaches only one voter, so both end term 1 with two
+	// votes of the three they need.
+	network.Partition([][]uint{{1, 2}, {3, 4}})
+	modules[0].ForceElection()
+	modules[2].ForceElection()
+	for _, candidate := range []*testModule{modules[0], modules[2]} {
+		if term, _, state := candidate.GetState(); term != 1 || state != Candidate {
+			t.Fatalf("node %d: term %d, %v; want a candidate in term 1", candidate.Id, term, state)
+		}
+	}
+
+	network.Heal()
+	for _, module := range modules {
+		start(t, module)
+	}
+	drain(modules...)
+	leader := waitLeader(t, modules)
+	if term, _, _ := leader.GetState(); term < 2 {
+		t.Errorf("leader elected in term %d, want a later election than the split one", term)
+	}
+}
+
+func TestVoteDuringElectionStart(t *testing.T) {
+	contact := &fakeContact{peers: []uint{2, 3}}
+	module, err := NewConsensusModule[string, int, bool](1, contact, NewMemoryStorage[string](), quiet, WithPreVote(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(module.Close)
+	for round := 0; round < 200; round++ {
+		term, _, _ := module.GetState()
+		// Node 2 asks for a vote in the very term our election moves to.
+		var reply Reply
+		var wg sync.WaitGroup
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			module.startElection()
+		}()
+		go func() {
+			defer wg.Done()
+			reply = module.Vote(RequestVote[string]{Term: term + 1, CandidateId: 2, LastLogIndex: 100, LastLogTerm: term + 1})
+		}()
+		wg.Wait()
+		// Either the vote went to node 2 and our election had to move on a
+		// term, or we stood in that term and voted for ourselves alone.
+		now, _, state := module.GetState()
+		module.Mutex.Lock()
+		votedFor := module.VotedFor
+		module.Mutex.Unlock()
+		if state != Candidate || votedFor != 1 {
+			t.Fatalf("round %d: %v voting for %d, want a candidate voting for itself", round, state, votedFor)
+		}
+		if reply.VoteGranted && now != term+2 {
+			t.Fatalf("round %d: voted for node 2 in term %d and stood in term %d", round, term+1, now)
+		}
+		if !reply.VoteGranted && now != term+1 {
+			t.Fatalf("round %d: refused node 2 in term %d but stood in term %d", round, term+1, now)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package raft
+
+import (
+	"slices"
+	"sync"
+	"time"
+)
+
+// Clock is the module's source of time: election and heartbeat timers,
+// leases and transfer deadlines all go through it, so a simulation can
+// replace it with a ManualClock. RPC timeouts are left in real time, since
+// they bound calls into the transport.
+type Clock interface {
+	Now() time.Time
+	NewTicker(d time.Duration) Ticker
+	After(d time.Duration) <-chan time.Time
+}
+
+// Ticker is a time.Ticker obtained from a Clock.
+type Ticker interface {
+	C() <-chan time.Time
+	Reset(d time.Duration)
+	Stop()
+}
+
+// RealClock is the Clock backed by package time. It is the default.
+type RealClock struct{}
+
+func (RealClock) Now() time.Time {
+	return time.Now()
+}
+
+func (RealClock) NewTicker(d time.Duration) Ticker {
+	return realTicker{time.NewTicker(d)}
+}
+
+func (RealClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+type realTicker struct {
+	ticker *time.Ticker
+}
+
+func (t realTicker) C() <-chan time.Time {
+	return t.ticker.C
+}
+
+func (t realTicker) Reset(d time.Duration) {
+	t.ticker.Reset(d)
+}
+
+func (t realTicker) Stop() {
+	t.ticker.Stop()
+}
+
+// ManualClock is a Clock that stands still until Advance moves it, so that
+// a test can set off elections and heartbeats one at a time. Giving
+// WithElectionTimeout and WithHeartbeatInterval an empty range takes the
+// jitter out as well. Like a time.Ticker, each of its tickers holds at most
+// one undelivered tick.
+type ManualClock struct {
+	mutex   sync.Mutex
+	now     time.Time
+	tickers []*manualTicker
+}
+
+// NewManualClock returns a ManualClock reading start.
+func NewManualClock(start time.Time) *ManualClock {
+	return &ManualClock{now: start}
+}
+
+func (m *ManualClock) Now() time.Time {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.now
+}
+
+func (m *ManualClock) NewTicker(d time.Duration) Ticker {
+	return m.add(d, false)
+}
+
+func (m *ManualClock) After(d time.Duration) <-chan time.Time {
+	return m.add(d, true).c
+}
+
+// Advance moves the clock forward by d and fires every ticker and After
+// that comes due, earliest first.
+func (m *ManualClock) Advance(d time.Duration) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.now = m.now.Add(d)
+	due := slices.DeleteFunc(slices.Clone(m.tickers), func(t *manualTicker) bool {
+		return t.next.After(m.now)
+	})
+	slices.SortStableFunc(due, func(a, b *manualTicker) int {
+		return a.next.Compare(b.next)
+	})
+	for _, t := range due {
+		select {
+		case t.c <- t.next:
+		default:
+		}
+		if t.once {
+			m.remove(t)
+			continue
+		}
+		for !t.next.After(m.now) {
+			t.next = t.next.Add(t.period)
+		}
+	}
+}
+
+// add registers a ticker firing every d, or only once. It panics on a
+// non-positive d as time.NewTicker does.
+func (m *ManualClock) add(d time.Duration, once bool) *manualTicker {
+	if d <= 0 && !once {
+		panic("raft: non-positive interval for ManualClock.NewTicker")
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	t := &manualTicker{
+		clock:  m,
+		c:      make(chan time.Time, 1),
+		period: d,
+		next:   m.now.Add(d),
+		once:   once,
+	}
+	m.tickers = append(m.tickers, t)
+	return t
+}
+
+// remove drops t from the tickers. It expects m.mutex to be held.
+func (m *ManualClock) remove(t *manualTicker) {
+	m.tickers = slices.DeleteFunc(m.tickers, func(other *manualTicker) bool {
+		return other == t
+	})
+}
+
+type manualTicker struct {
+	clock  *ManualClock
+	c      chan time.Time
+	period time.Duration
+	next   time.Time
+	once   bool
+}
+
+func (t *manualTicker) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *manualTicker) Reset(d time.Duration) {
+	if d <= 0 {
+		panic("raft: non-positive interval for Ticker.Reset")
+	}
+	t.clock.mutex.Lock()
+	defer t.clock.mutex.Unlock()
+	t.period = d
+	t.next = t.clock.now.Add(d)
+	if !slices.Contains(t.clock.tickers, t) {
+		t.clock.tickers = append(t.clock.tickers, t)
+	}
+}
+
+func (t *manualTicker) Stop() {
+	t.clock.mutex.Lock()
+	defer t.clock.mutex.Unlock()
+	t.clock.remove(t)
+}
@@ -0,0 +1,44 @@
+package raft
+
+import (
+	"testing"
+	"time"
+)
+
+func TestElectionOnManualClock(t *testing.T) {
+	clock := NewManualClock(time.Unix(0, 0))
+	network := NewInMemoryNetwork[string, int, bool]()
+	var modules []*testModule
+	for id, timeout := range []time.Duration{time.Hour, 2 * time.Hour, 2 * time.Hour} {
+		// Empty ranges leave no jitter: node 1 times out first, and alone,
+		// and no election can start in the real time the test takes.
+		module, err := network.Add(uint(id+1), NewMemoryStorage[string](),
+			WithClock(clock),
+			WithElectionTimeout(timeout, timeout),
+			WithHeartbeatInterval(20*time.Millisecond, 20*time.Millisecond))
+		if err != nil {
+			t.Fatal(err)
+		}
+		modules = append(modules, module)
+	}
+	changes := modules[0].LeaderChanges()
+	for _, module := range modules {
+		start(t, module)
+	}
+
+	clock.Advance(time.Hour)
+	select {
+	case leader := <-changes:
+		if !leader {
+			t.Fatal("node 1 reported losing leadership it never had")
+		}
+	case <-time.After(waitTimeout):
+		t.Fatal("node 1 did not win once its election timeout passed")
+	}
+	for _, module := range modules {
+		term, isLeader, _ := module.GetState()
+		if term != 1 || isLeader != (module == modules[0]) {
+			t.Errorf("node %d: term %d, leader %v; want node 1 elected in term 1", module.Id, term, isLeader)
+		}
+	}
+}
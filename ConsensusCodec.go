@@ -0,0 +1,88 @@
+package raft
+
+import "encoding/json"
+
+// Codec turns commands into bytes and back, for the storages that keep them
+// on disk and the transports that send them to peers.
+type Codec[j any] interface {
+	Encode(command j) ([]byte, error)
+	Decode(data []byte) (j, error)
+}
+
+// JSONCodec encodes commands with encoding/json. It is the codec used unless
+// WithCodec gives another.
+type JSONCodec[j any] struct{}
+
+func (JSONCodec[j]) Encode(command j) ([]byte, error) {
+	return json.Marshal(command)
+}
+
+func (JSONCodec[j]) Decode(data []byte) (j, error) {
+	var command j
+	err := json.Unmarshal(data, &command)
+	return command, err
+}
+
+// CodecUser is implemented by a Storage or Contact that encodes commands.
+// NewConsensusModule hands it the module's codec before anything is loaded
+// or sent.
+type CodecUser[j any] interface {
+	UseCodec(codec Codec[j])
+}
+
+// encodedEntry is a LogEntry with its command encoded, as the storages keep
+// it.
+type encodedEntry struct {
+	Command       []byte
+	Term          Term
+	Type          LogEntryType
+	Configuration []uint
+	Learners      []uint
+	ClientId      uint
+	Seq           uint
+}
+
+func encodeEntry[j any](codec Codec[j], entry LogEntry[j]) (encodedEntry, error) {
+	command, err := codec.Encode(entry.Command)
+	if err != nil {
+		return encodedEntry{}, err
+	}
+	return encodedEntry{
+		Command:       command,
+		Term:          entry.Term,
+		Type:          entry.Type,
+		Configuration: entry.Configuration,
+		Learners:      entry.Learners,
+		ClientId:      entry.ClientId,
+		Seq:           entry.Seq,
+	}, nil
+}
+
+func decodeEntry[j any](codec Codec[j], entry encodedEntry) (LogEntry[j], error) {
+	command, err := codec.Decode(entry.Command)
+	if err != nil {
+		return LogEntry[j]{}, err
+	}
+	return LogEntry[j]{
+		Command:       command,
+		Term:          entry.Term,
+		Type:          entry.Type,
+		Configuration: entry.Configuration,
+		Learners:      entry.Learners,
+		ClientId:      entry.ClientId,
+		Seq:           entry.Seq,
+	}, nil
+}
+
+// decodeEntries decodes a stored log.
+func decodeEntries[j any](codec Codec[j], entries []encodedEntry) ([]LogEntry[j], error) {
+	log := make([]LogEntry[j], 0, len(entries))
+	for _, entry := range entries {
+		decoded, err := decodeEntry(codec, entry)
+		if err != nil {
+			return nil, err
+		}
+		log = append(log, decoded)
+	}
+	return log, nil
+}
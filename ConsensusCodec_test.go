@@ -0,0 +1,102 @@
+package raft
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// order is a command with more structure than a string.
+type order struct {
+	Id    int
+	Items map[string]int
+	Notes []string
+}
+
+// gobCodec encodes commands with encoding/gob.
+type gobCodec[j any] struct{}
+
+func (gobCodec[j]) Encode(command j) ([]byte, error) {
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(command)
+	return buf.Bytes(), err
+}
+
+func (gobCodec[j]) Decode(data []byte) (j, error) {
+	var command j
+	err := gob.NewDecoder(bytes.NewReader(data)).Decode(&command)
+	return command, err
+}
+
+func TestStructCommand(t *testing.T) {
+	dir := t.TempDir()
+	path := func(id uint) string { return filepath.Join(dir, fmt.Sprintf("node%d.json", id)) }
+	network := NewInMemoryNetwork[order, int, bool]()
+	network.order = []uint{1, 2, 3}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var modules []*ConsensusModule[order, int, bool]
+	for _, id := range network.order {
+		storage, err := NewFileStorage[order](path(id))
+		if err != nil {
+			t.Fatal(err)
+		}
+		module, err := network.Add(id, storage, WithCodec[order](gobCodec[order]{}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(module.Close)
+		module.Start(ctx)
+		modules = append(modules, module)
+	}
+	var leader *ConsensusModule[order, int, bool]
+	deadline := time.Now().Add(waitTimeout)
+	for leader == nil {
+		if time.Now().After(deadline) {
+			t.Fatal("no leader")
+		}
+		time.Sleep(5 * time.Millisecond)
+		for _, module := range modules {
+			if _, isLeader, _ := module.GetState(); isLeader {
+				leader = module
+			}
+		}
+	}
+
+	want := order{Id: 7, Items: map[string]int{"apple": 2, "pear": 1}, Notes: []string{"gift"}}
+	proposeCtx, proposeCancel := context.WithTimeout(ctx, waitTimeout)
+	defer proposeCancel()
+	index, _, err := leader.ProposeWait(proposeCtx, want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, module := range modules {
+		select {
+		case msg := <-module.ReceiveChan:
+			if !reflect.DeepEqual(msg.Command, want) {
+				t.Errorf("node %d applied %+v, want %+v", module.Id, msg.Command, want)
+			}
+		case <-time.After(waitTimeout):
+			t.Fatalf("node %d applied nothing", module.Id)
+		}
+	}
+
+	leader.Close()
+	storage, err := NewFileStorage[order](path(leader.Id))
+	if err != nil {
+		t.Fatal(err)
+	}
+	storage.UseCodec(gobCodec[order]{})
+	log, err := storage.LoadLog()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(log) < int(index) || !reflect.DeepEqual(log[index-1].Command, want) {
+		t.Errorf("saved log %+v, want %+v at index %d", log, want, index)
+	}
+}
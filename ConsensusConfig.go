@@ -0,0 +1,337 @@
+package raft
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	defaultBufferSize   = 64
+	defaultMaxBatchSize = 64
+	defaultMaxInflight  = 4
+)
+
+// Config holds the tunables for a ConsensusModule. It is filled in from the
+// defaults and then each Option passed to NewConsensusModule.
+type Config struct {
+	// BufferSize is the capacity of ReceiveChan and ApplyBatchChan.
+	BufferSize int
+
+	// ApplyBatchSize caps how many committed commands the apply loop hands
+	// off at once. Above one, they go in batches on ApplyBatchChan instead of
+	// ReceiveChan, or to the FSM's ApplyBatch when it is a BatchFSM; one or
+	// less hands each off on its own.
+	ApplyBatchSize int
+
+	// ApplyTimeout is how long a committed entry may wait for room on
+	// ReceiveChan before a warning is logged. Delivery keeps waiting either
+	// way, since dropping an entry would corrupt the state machine; zero
+	// waits silently.
+	ApplyTimeout time.Duration
+
+	// AppliedIndex is the last index the application's own persisted state
+	// already reflects. Delivery on ReceiveChan resumes after it instead of
+	// after the restored snapshot, so a restart does not apply anything
+	// twice. Zero suits an application that rebuilds its state from
+	// ReceiveChan every time.
+	AppliedIndex Index
+
+	// Followers and candidates start an election after a random timeout in
+	// [ElectionTimeoutMin, ElectionTimeoutMax).
+	ElectionTimeoutMin time.Duration
+	ElectionTimeoutMax time.Duration
+
+	// Leaders send heartbeats after a random interval in
+	// [HeartbeatIntervalMin, HeartbeatIntervalMax).
+	HeartbeatIntervalMin time.Duration
+	HeartbeatIntervalMax time.Duration
+
+	// Seed seeds the random source election timeouts and heartbeat
+	// intervals are drawn from, mixed with the module's id so that nodes
+	// given the same seed still time out apart. Zero seeds it from the
+	// current time; anything else replays the same sequence of timeouts.
+	Seed int64
+
+	// PreVote makes a node check that it could win before starting a real
+	// election, so a node cut off from the cluster cannot inflate its term.
+	PreVote bool
+
+	// LeaseDuration is how long a leader trusts a heartbeat round answered by
+	// a majority to serve LeaseRead without contacting anyone. It must be
+	// shorter than ElectionTimeoutMin to be safe.
+	LeaseDuration time.Duration
+
+	// LeaderStickiness makes a node refuse real votes, as Pre-Vote refuses
+	// pre-votes, while it is leader or has heard from one within
+	// ElectionTimeoutMin, so that a node whose elections skip Pre-Vote
+	// cannot depose a healthy leader. Elections for a leadership transfer
+	// are still let through. It is meant to be paired with CheckQuorum, or a
+	// leader cut off from the majority would keep the followers it can still
+	// reach from electing another.
+	LeaderStickiness bool
+
+	// CheckQuorum makes a leader step down when a majority has not answered
+	// it within an election timeout, so a leader cut off from the cluster
+	// stops acting as one instead of waiting to hear of a higher term.
+	CheckQuorum bool
+
+	// MaxBatchSize caps the entries sent to a peer in one AppendEntries, so
+	// a follower far behind is caught up in chunks rather than one huge RPC.
+	// Zero or less sends everything the peer is missing.
+	MaxBatchSize int
+
+	// MaxInflight is how many AppendEntries a leader keeps outstanding to a
+	// peer before waiting for a reply. One, or anything less, gives
+	// lock-step replication.
+	MaxInflight int
+
+	// Once SnapshotThreshold entries have been applied since the last
+	// snapshot, SnapshotFunc is asked for the application's state and the
+	// log is compacted with it. A nil SnapshotFunc falls back on the FSM's
+	// Snapshot. A threshold of zero or less, or no way to take a snapshot,
+	// leaves snapshots to explicit Snapshot calls.
+	SnapshotThreshold int
+	SnapshotFunc      SnapshotFunc
+
+	// Metrics is told about elections, term changes, commits and replication
+	// lag.
+	Metrics Metrics
+
+	// Logger receives the module's log lines.
+	Logger Logger
+
+	// Clock times elections, heartbeats, leases and leadership transfers.
+	Clock Clock
+
+	// Codec encodes commands for the Storage and Contact. Set with WithCodec,
+	// it has to be a Codec of the module's command type; nil means
+	// JSONCodec.
+	Codec any
+
+	// FSM is the state machine the module applies committed commands to
+	// instead of delivering them on ReceiveChan. Set with WithFSM, it has to
+	// be an FSM of the module's command type; nil means ReceiveChan.
+	FSM any
+
+	// Learner starts the module as a non-voting learner that never stands
+	// for election, for a server about to be added with AddLearner. Once a
+	// configuration entry has committed, that alone decides whether the
+	// module votes.
+	Learner bool
+}
+
+// SnapshotFunc returns the application's serialized state together with the
+// last index it reflects, which must already have been applied. It is called
+// from the apply loop, so nothing is delivered on ReceiveChan while it runs.
+type SnapshotFunc func() (index Index, state []byte, err error)
+
+// Option adjusts the Config of a module under construction.
+type Option func(*Config)
+
+func defaultConfig() Config {
+	return Config{
+		BufferSize:           defaultBufferSize,
+		ElectionTimeoutMin:   250 * time.Millisecond,
+		ElectionTimeoutMax:   450 * time.Millisecond,
+		HeartbeatIntervalMin: 50 * time.Millisecond,
+		HeartbeatIntervalMax: 200 * time.Millisecond,
+		PreVote:              true,
+		LeaseDuration:        200 * time.Millisecond,
+		MaxBatchSize:         defaultMaxBatchSize,
+		MaxInflight:          defaultMaxInflight,
+		Metrics:              NoopMetrics{},
+		Logger:               NoopLogger{},
+		Clock:                RealClock{},
+	}
+}
+
+// validate rejects timings the module cannot run with: non-positive election
+// timeouts or heartbeat intervals, ranges whose minimum is above their
+// maximum, heartbeats that may not arrive before an election timeout, and a
+// lease that would outlast the shortest election timeout.
+func (config Config) validate() error {
+	switch {
+	case config.ElectionTimeoutMin <= 0 || config.HeartbeatIntervalMin <= 0:
+		return fmt.Errorf("%w: election timeouts and heartbeat intervals must be positive", ErrInvalidConfig)
+	case config.ElectionTimeoutMin > config.ElectionTimeoutMax:
+		return fmt.Errorf("%w: election timeout minimum %v is above maximum %v", ErrInvalidConfig, config.ElectionTimeoutMin, config.ElectionTimeoutMax)
+	case config.HeartbeatIntervalMin > config.HeartbeatIntervalMax:
+		return fmt.Errorf("%w: heartbeat interval minimum %v is above maximum %v", ErrInvalidConfig, config.HeartbeatIntervalMin, config.HeartbeatIntervalMax)
+	case config.HeartbeatIntervalMax >= config.ElectionTimeoutMin:
+		return fmt.Errorf("%w: heartbeat interval %v is not below election timeout %v", ErrInvalidConfig, config.HeartbeatIntervalMax, config.ElectionTimeoutMin)
+	case config.LeaseDuration < 0 || config.LeaseDuration >= config.ElectionTimeoutMin:
+		return fmt.Errorf("%w: lease %v is not below election timeout %v", ErrInvalidConfig, config.LeaseDuration, config.ElectionTimeoutMin)
+	case config.BufferSize < 0:
+		return fmt.Errorf("%w: negative buffer size %d", ErrInvalidConfig, config.BufferSize)
+	}
+	return nil
+}
+
+// WithBufferSize sets the capacity of ReceiveChan and ApplyBatchChan.
+func WithBufferSize(size int) Option {
+	return func(config *Config) {
+		config.BufferSize = size
+	}
+}
+
+// WithApplyBatchSize has the apply loop hand off up to size committed
+// commands at once.
+func WithApplyBatchSize(size int) Option {
+	return func(config *Config) {
+		config.ApplyBatchSize = size
+	}
+}
+
+// WithApplyTimeout warns when a committed entry waits longer than timeout
+// for room on ReceiveChan.
+func WithApplyTimeout(timeout time.Duration) Option {
+	return func(config *Config) {
+		config.ApplyTimeout = timeout
+	}
+}
+
+// WithAppliedIndex resumes delivery on ReceiveChan after index, which the
+// application has already applied.
+func WithAppliedIndex(index Index) Option {
+	return func(config *Config) {
+		config.AppliedIndex = index
+	}
+}
+
+// WithClock runs the module's timers off clock, or the real clock when nil.
+func WithClock(clock Clock) Option {
+	return func(config *Config) {
+		if clock == nil {
+			clock = RealClock{}
+		}
+		config.Clock = clock
+	}
+}
+
+// WithCodec sets the codec commands are stored and sent with.
+func WithCodec[j any](codec Codec[j]) Option {
+	return func(config *Config) {
+		config.Codec = codec
+	}
+}
+
+// WithFSM has the module apply committed commands to fsm itself.
+func WithFSM[j any](fsm FSM[j]) Option {
+	return func(config *Config) {
+		config.FSM = fsm
+	}
+}
+
+// WithElectionTimeout sets the range election timeouts are drawn from. Both
+// heartbeat intervals and the lease have to stay below min.
+func WithElectionTimeout(min, max time.Duration) Option {
+	return func(config *Config) {
+		config.ElectionTimeoutMin = min
+		config.ElectionTimeoutMax = max
+	}
+}
+
+// WithHeartbeatInterval sets the range leader heartbeat intervals are drawn
+// from.
+func WithHeartbeatInterval(min, max time.Duration) Option {
+	return func(config *Config) {
+		config.HeartbeatIntervalMin = min
+		config.HeartbeatIntervalMax = max
+	}
+}
+
+// WithSeed fixes the seed election timeouts and heartbeat intervals are drawn
+// with, so that a test can replay the same elections.
+func WithSeed(seed int64) Option {
+	return func(config *Config) {
+		config.Seed = seed
+	}
+}
+
+// WithPreVote turns the Pre-Vote phase before elections on or off.
+func WithPreVote(enabled bool) Option {
+	return func(config *Config) {
+		config.PreVote = enabled
+	}
+}
+
+// WithLeaseDuration sets how long a leader lease lasts after a majority
+// answers a heartbeat round. It has to be shorter than ElectionTimeoutMin;
+// zero holds no lease at all.
+func WithLeaseDuration(lease time.Duration) Option {
+	return func(config *Config) {
+		config.LeaseDuration = lease
+	}
+}
+
+// WithLeaderStickiness turns on or off refusing votes while a leader is
+// known to be alive.
+func WithLeaderStickiness(enabled bool) Option {
+	return func(config *Config) {
+		config.LeaderStickiness = enabled
+	}
+}
+
+// WithCheckQuorum turns on or off a leader stepping down once it loses
+// contact with a majority.
+func WithCheckQuorum(enabled bool) Option {
+	return func(config *Config) {
+		config.CheckQuorum = enabled
+	}
+}
+
+// WithMaxBatchSize caps the entries sent to a peer in one AppendEntries.
+func WithMaxBatchSize(size int) Option {
+	return func(config *Config) {
+		config.MaxBatchSize = size
+	}
+}
+
+// WithMaxAppendEntries caps the entries sent to a peer in one AppendEntries,
+// by setting Config.MaxBatchSize exactly as WithMaxBatchSize does.
+func WithMaxAppendEntries(count int) Option {
+	return WithMaxBatchSize(count)
+}
+
+// WithMaxInflight sets how many AppendEntries a leader keeps outstanding to a
+// peer.
+func WithMaxInflight(count int) Option {
+	return func(config *Config) {
+		config.MaxInflight = count
+	}
+}
+
+// WithSnapshotThreshold compacts the log with a snapshot from snapshot every
+// time threshold entries have been applied since the last one.
+func WithSnapshotThreshold(threshold int, snapshot SnapshotFunc) Option {
+	return func(config *Config) {
+		config.SnapshotThreshold = threshold
+		config.SnapshotFunc = snapshot
+	}
+}
+
+// WithMetrics reports the module's events to metrics.
+func WithMetrics(metrics Metrics) Option {
+	return func(config *Config) {
+		config.Metrics = metrics
+	}
+}
+
+// WithLearner starts the module as a learner that does not stand for
+// election until it is promoted.
+func WithLearner() Option {
+	return func(config *Config) {
+		config.Learner = true
+	}
+}
+
+// WithLogger sends the module's log lines to logger, or discards them when
+// logger is nil.
+func WithLogger(logger Logger) Option {
+	return func(config *Config) {
+		if logger == nil {
+			logger = NoopLogger{}
+		}
+		config.Logger = logger
+	}
+}
@@ -0,0 +1,65 @@
+package raft
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestInvalidConfig(t *testing.T) {
+	tests := map[string][]Option{
+		"zero election timeout":     {WithElectionTimeout(0, 0)},
+		"negative heartbeat":        {WithHeartbeatInterval(-time.Millisecond, time.Millisecond)},
+		"election minimum over max": {WithElectionTimeout(time.Second, 500*time.Millisecond)},
+		"heartbeat minimum over max": {
+			WithHeartbeatInterval(100*time.Millisecond, 50*time.Millisecond),
+		},
+		"heartbeat not below election timeout": {
+			WithHeartbeatInterval(200*time.Millisecond, 300*time.Millisecond),
+			WithElectionTimeout(300*time.Millisecond, 400*time.Millisecond),
+		},
+		"lease not below election timeout": {WithLeaseDuration(250 * time.Millisecond)},
+		"negative lease":                   {WithLeaseDuration(-time.Millisecond)},
+		"negative buffer":                  {WithBufferSize(-1)},
+	}
+	for name, options := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := NewInMemoryNetwork[string, int, bool]().Add(1, NewMemoryStorage[string](), options...)
+			if !errors.Is(err, ErrInvalidConfig) {
+				t.Fatalf("NewConsensusModule = %v, want ErrInvalidConfig", err)
+			}
+		})
+	}
+}
+
+func TestValidConfig(t *testing.T) {
+	tests := map[string][]Option{
+		"defaults": nil,
+		"fixed intervals": {
+			WithElectionTimeout(time.Second, time.Second),
+			WithHeartbeatInterval(100*time.Millisecond, 100*time.Millisecond),
+		},
+		"no lease": {WithLeaseDuration(0)},
+	}
+	for name, options := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := NewInMemoryNetwork[string, int, bool]().Add(1, NewMemoryStorage[string](), options...); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestShortTimeoutsElectQuickly(t *testing.T) {
+	started := time.Now()
+	modules, _ := startCluster(t, 3,
+		WithElectionTimeout(20*time.Millisecond, 40*time.Millisecond),
+		WithHeartbeatInterval(5*time.Millisecond, 10*time.Millisecond),
+		WithLeaseDuration(10*time.Millisecond),
+	)
+	waitLeader(t, modules)
+	// With the default timeouts no election can even start this soon.
+	if elapsed := time.Since(started); elapsed >= 250*time.Millisecond {
+		t.Errorf("elected a leader after %v, want under 250ms", elapsed)
+	}
+}
@@ -0,0 +1,129 @@
+package raft
+
+import "context"
+
+// FSM is a state machine the module drives itself, in place of an application
+// reading ReceiveChan. Set with WithFSM, nothing is delivered on ReceiveChan:
+// Apply is called from the apply loop for every committed command, in log
+// order, and what it returns is handed to the ProposeApply call that proposed
+// the entry. Restore replaces the state with a snapshot restored from storage
+// or installed by the leader, and Snapshot captures it for automatic
+// snapshots when Config.SnapshotFunc is not set.
+type FSM[j any] interface {
+	Apply(entry LogEntry[j]) any
+	Snapshot() ([]byte, error)
+	Restore(snapshot []byte) error
+}
+
+// BatchFSM is an FSM that can apply a batch of commands in one call, which
+// the module uses with Config.ApplyBatchSize above one. ApplyBatch returns a
+// result for each message, in order; the messages carry the index and term of
+// their entries.
+type BatchFSM[j any] interface {
+	FSM[j]
+	ApplyBatch(messages []ApplyMsg[j]) []any
+}
+
+// applyResult is where the apply loop leaves what the FSM returned for an
+// entry proposed through ProposeApply in term.
+type applyResult struct {
+	term  Term
+	value any
+}
+
+// ProposeApply is ProposeWait that also returns what the FSM's Apply returned
+// for the entry. Without an FSM the result is always nil.
+func (c *ConsensusModule[j, x, k]) ProposeApply(ctx context.Context, command j) (any, error) {
+	return c.ProposeOnceApply(ctx, 0, 0, command)
+}
+
+// ProposeOnceApply is ProposeApply for a client that retries, with clientId
+// and seq as for ProposeOnce. A retry of the client's last applied request
+// is not appended again and gets the result the first application returned,
+// as does one that reached the log twice; a retry of an earlier request gets
+// nil.
+func (c *ConsensusModule[j, x, k]) ProposeOnceApply(ctx context.Context, clientId, seq uint, command j) (any, error) {
+	peers := c.peerIds()
+	c.Mutex.Lock()
+	defer c.Mutex.Unlock()
+	if c.State == Leader && !c.transferring && clientId != 0 {
+		if session, ok := c.sessions[clientId]; ok && seq <= session.Seq {
+			return c.sessionResult(clientId, seq), nil
+		}
+	}
+	index, term, isLeader := c.propose(peers, LogEntry[j]{
+		Command:  command,
+		ClientId: clientId,
+		Seq:      seq,
+	})
+	if !isLeader {
+		return nil, c.notLeader()
+	}
+	result := &applyResult{term: term}
+	c.results[index] = result
+	defer func() {
+		if c.results[index] == result {
+			delete(c.results, index)
+		}
+	}()
+	if err := c.waitForApply(ctx, index, term); err != nil {
+		return nil, err
+	}
+	if clientId != 0 {
+		return c.sessionResult(clientId, seq), nil
+	}
+	return result.value, nil
+}
+
+// sessionResult returns the result recorded for the request seq of clientId,
+// or nil once the client has moved past it. It expects c.Mutex to be held.
+func (c *ConsensusModule[j, x, k]) sessionResult(clientId, seq uint) any {
+	if session := c.sessions[clientId]; session.Seq == seq {
+		return session.Result
+	}
+	return nil
+}
+
+// handOff gives batch, as made by nextBatch, to the FSM when there is one,
+// returning what it made of each message, and otherwise delivers it to the
+// application. It reports false if ctx is done first. A snapshot the FSM
+// fails to restore is logged and skipped.
+func (c *ConsensusModule[j, x, k]) handOff(ctx context.Context, batch []ApplyMsg[j]) ([]any, bool) {
+	if c.fsm == nil {
+		return nil, c.deliver(ctx, batch)
+	}
+	if ctx.Err() != nil {
+		return nil, false
+	}
+	if batch[0].SnapshotValid {
+		if err := c.fsm.Restore(batch[0].Snapshot); err != nil {
+			c.Mutex.Lock()
+			c.warn("restoring the state machine failed", "index", batch[0].Index, "err", err)
+			c.Mutex.Unlock()
+		}
+		return nil, true
+	}
+	if batcher, ok := c.fsm.(BatchFSM[j]); ok && c.Config.ApplyBatchSize > 1 {
+		return batcher.ApplyBatch(batch), true
+	}
+	values := make([]any, len(batch))
+	for i, message := range batch {
+		values[i] = c.fsm.Apply(LogEntry[j]{
+			Command:  message.Command,
+			Term:     message.Term,
+			ClientId: message.ClientId,
+			Seq:      message.Seq,
+		})
+	}
+	return values, true
+}
+
+// fsmSnapshot is the SnapshotFunc used with an FSM. It is only called from
+// the apply loop, so the FSM's state is exactly that of LastApplied.
+func (c *ConsensusModule[j, x, k]) fsmSnapshot() (Index, []byte, error) {
+	c.Mutex.Lock()
+	index := c.LastApplied
+	c.Mutex.Unlock()
+	state, err := c.fsm.Snapshot()
+	return index, state, err
+}
@@ -0,0 +1,210 @@
+package raft
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// kvFSM is an FSM of "SET key value" commands. Apply returns the value the
+// key held before, and applied counts the commands applied since the last
+// Restore.
+type kvFSM struct {
+	mutex    sync.Mutex
+	values   map[string]string
+	applied  int
+	restores int
+}
+
+func newKVFSM() *kvFSM {
+	return &kvFSM{values: make(map[string]string)}
+}
+
+func (f *kvFSM) Apply(entry LogEntry[string]) any {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.applied++
+	_, command, _ := strings.Cut(entry.Command, "SET ")
+	key, value, _ := strings.Cut(command, " ")
+	previous := f.values[key]
+	f.values[key] = value
+	return previous
+}
+
+func (f *kvFSM) Snapshot() ([]byte, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return json.Marshal(f.values)
+}
+
+func (f *kvFSM) Restore(snapshot []byte) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.restores++
+	f.applied = 0
+	f.values = make(map[string]string)
+	return json.Unmarshal(snapshot, &f.values)
+}
+
+func (f *kvFSM) get(key string) string {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.values[key]
+}
+
+func (f *kvFSM) count() int {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.applied
+}
+
+// startFSMCluster is startCluster with a kvFSM of its own for each module.
+func startFSMCluster(t testing.TB, n int, options ...Option) ([]*testModule, []*kvFSM, *InMemoryNetwork[string, int, bool]) {
+	t.Helper()
+	network := NewInMemoryNetwork[string, int, bool]()
+	for id := uint(1); id <= uint(n); id++ {
+		network.order = append(network.order, id)
+	}
+	var modules []*testModule
+	var fsms []*kvFSM
+	for id := uint(1); id <= uint(n); id++ {
+		fsm := newKVFSM()
+		module, err := network.Add(id, NewMemoryStorage[string](), append(options, WithFSM[string](fsm))...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		modules = append(modules, module)
+		fsms = append(fsms, fsm)
+	}
+	for _, module := range modules {
+		start(t, module)
+	}
+	return modules, fsms, network
+}
+
+func TestKVFSMAppliesProposals(t *testing.T) {
+	modules, fsms, _ := startFSMCluster(t, 3, quiet)
+	leader := modules[0]
+	leader.ForceElection()
+	ctx, cancel := context.WithTimeout(context.Background(), waitTimeout)
+	defer cancel()
+	for _, step := range []struct{ command, previous string }{
+		{"SET a 1", ""},
+		{"SET b 7", ""},
+		{"SET a 2", "1"},
+	} {
+		result, err := leader.ProposeApply(ctx, step.command)
+		if err != nil {
+			t.Fatalf("ProposeApply(%q) = %v", step.command, err)
+		}
+		if result != step.previous {
+			t.Errorf("ProposeApply(%q) = %v, want %q", step.command, result, step.previous)
+		}
+	}
+	waitFor(t, "every FSM to apply the proposals", func() bool {
+		for _, fsm := range fsms {
+			if fsm.count() < 3 {
+				return false
+			}
+		}
+		return true
+	})
+	for i, fsm := range fsms {
+		if a, b := fsm.get("a"), fsm.get("b"); a != "2" || b != "7" {
+			t.Errorf("node %d holds a=%q b=%q, want a=2 b=7", modules[i].Id, a, b)
+		}
+	}
+	select {
+	case msg := <-leader.ReceiveChan:
+		t.Errorf("ReceiveChan delivered %+v alongside the FSM", msg)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+// batchFSM is a BatchFSM that records what it applies and in how many calls.
+type batchFSM struct {
+	mutex   sync.Mutex
+	applied []ApplyMsg[string]
+	calls   int
+	largest int
+}
+
+func (f *batchFSM) Apply(entry LogEntry[string]) any {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.calls++
+	f.largest = max(f.largest, 1)
+	f.applied = append(f.applied, ApplyMsg[string]{Command: entry.Command, Term: entry.Term})
+	return nil
+}
+
+func (f *batchFSM) ApplyBatch(messages []ApplyMsg[string]) []any {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.calls++
+	f.largest = max(f.largest, len(messages))
+	f.applied = append(f.applied, messages...)
+	return make([]any, len(messages))
+}
+
+func (f *batchFSM) Snapshot() ([]byte, error) { return nil, nil }
+func (f *batchFSM) Restore([]byte) error      { return nil }
+
+func TestApplyBatchKeepsOrder(t *testing.T) {
+	const proposals, batch = 200, 16
+	fsm := &batchFSM{}
+	modules, _ := startCluster(t, 1, WithFSM[string](fsm), WithApplyBatchSize(batch))
+	module := waitLeader(t, modules)
+	var last Index
+	for i := 0; i < proposals; i++ {
+		last, _, _ = module.Propose(fmt.Sprintf("SET k %d", i))
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), waitTimeout)
+	defer cancel()
+	if err := module.WaitForApply(ctx, last); err != nil {
+		t.Fatal(err)
+	}
+
+	fsm.mutex.Lock()
+	defer fsm.mutex.Unlock()
+	if len(fsm.applied) != proposals {
+		t.Fatalf("applied %d commands, want %d", len(fsm.applied), proposals)
+	}
+	for i, msg := range fsm.applied {
+		want := ApplyMsg[string]{Command: fmt.Sprintf("SET k %d", i), Index: last - proposals + Index(i) + 1, Term: 1}
+		if msg.Command != want.Command || msg.Index != want.Index || msg.Term != want.Term {
+			t.Fatalf("command %d applied as %+v, want %+v", i, msg, want)
+		}
+	}
+	if fsm.largest > batch {
+		t.Errorf("a batch held %d commands, more than %d", fsm.largest, batch)
+	}
+	if fsm.calls >= proposals {
+		t.Errorf("%d commands took %d calls, want them batched", proposals, fsm.calls)
+	}
+}
+
+func BenchmarkApply(b *testing.B) {
+	for name, batch := range map[string]int{"per-entry": 1, "batched": 64} {
+		b.Run(name, func(b *testing.B) {
+			modules, _ := newCluster(b, 1, WithFSM[string](&batchFSM{}), WithApplyBatchSize(batch))
+			module := modules[0]
+			// The entries are in the log before the node starts, so what is
+			// timed is electing it, which commits them all, and applying them.
+			appendTerms(module, repeat(1, b.N)...)
+			setTerm(module, 1, -1)
+			last := module.LastLogIndex()
+			b.ResetTimer()
+			start(b, module)
+			ctx, cancel := context.WithTimeout(context.Background(), waitTimeout)
+			defer cancel()
+			if err := module.WaitForApply(ctx, last); err != nil {
+				b.Fatal(err)
+			}
+		})
+	}
+}
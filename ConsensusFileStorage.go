@@ -0,0 +1,162 @@
+package raft
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+)
+
+// FileStorage is a Storage that keeps term, vote, snapshot and log in a
+// single JSON file. Every save writes a temporary file, syncs it and renames
+// it over the old one, so a crash leaves either the previous or the new state
+// on disk. Commands are encoded with the module's Codec.
+type FileStorage[j any] struct {
+	mutex sync.Mutex
+	path  string
+	codec Codec[j]
+	state fileState
+}
+
+type fileState struct {
+	Term     Term
+	VotedFor int
+	Log      []encodedEntry
+
+	LastIncludedIndex Index
+	LastIncludedTerm  Term
+	Snapshot          []byte
+}
+
+// NewFileStorage opens the state file at path, loading it if it exists.
+func NewFileStorage[j any](path string) (*FileStorage[j], error) {
+	f := &FileStorage[j]{
+		path:  path,
+		codec: JSONCodec[j]{},
+		state: fileState{VotedFor: -1},
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return f, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &f.state); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// UseCodec sets the codec commands are encoded with. Entries already on disk
+// are decoded with it too, so it has to match the one they were saved with.
+func (f *FileStorage[j]) UseCodec(codec Codec[j]) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.codec = codec
+}
+
+func (f *FileStorage[j]) SaveState(term Term, votedFor int) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	next := f.state
+	next.Term = term
+	next.VotedFor = votedFor
+	return f.write(next)
+}
+
+func (f *FileStorage[j]) LoadState() (Term, int, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.state.Term, f.state.VotedFor, nil
+}
+
+func (f *FileStorage[j]) SaveLog(entries []LogEntry[j]) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	next := f.state
+	next.Log = make([]encodedEntry, 0, len(entries))
+	for _, entry := range entries {
+		encoded, err := encodeEntry(f.codec, entry)
+		if err != nil {
+			return err
+		}
+		next.Log = append(next.Log, encoded)
+	}
+	return f.write(next)
+}
+
+func (f *FileStorage[j]) LoadLog() ([]LogEntry[j], error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return decodeEntries(f.codec, f.state.Log)
+}
+
+func (f *FileStorage[j]) SaveSnapshot(lastIncludedIndex Index, lastIncludedTerm Term, data []byte) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	next := f.state
+	next.Log = trimLog(f.state.Log, func(entry encodedEntry) Term { return entry.Term }, f.state.LastIncludedIndex, lastIncludedIndex, lastIncludedTerm)
+	next.LastIncludedIndex = lastIncludedIndex
+	next.LastIncludedTerm = lastIncludedTerm
+	next.Snapshot = slices.Clone(data)
+	return f.write(next)
+}
+
+func (f *FileStorage[j]) LoadSnapshot() (Index, Term, []byte, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.state.LastIncludedIndex, f.state.LastIncludedTerm, slices.Clone(f.state.Snapshot), nil
+}
+
+// write atomically replaces the file with state and only then adopts it as
+// the cached copy. It expects f.mutex to be held.
+func (f *FileStorage[j]) write(state fileState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(f.path, data); err != nil {
+		return err
+	}
+	f.state = state
+	return nil
+}
+
+// writeFileAtomic replaces the file at path with data by writing and syncing
+// a temporary file and renaming it over the old one.
+func writeFileAtomic(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+	syncDir(dir)
+	return nil
+}
+
+// syncDir makes renames and removals in dir durable, on a best-effort basis
+// since not every platform can sync a directory.
+func syncDir(dir string) {
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+}
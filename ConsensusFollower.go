@@ -1,11 +1,149 @@
 package raft
 
+import "fmt"
+
 func (c *ConsensusModule[j, k, x]) followerToCandidate() {
+	c.Mutex.Lock()
 	clear(c.MatchIndex)
 	clear(c.NextIndex)
-	if c.validCandidate() {
-		c.State = Candidate
-		c.CurrentTerm++
-		c.handleCandidate()
+	c.Mutex.Unlock()
+	c.startElection()
+}
+
+// ForceElection fires the election timeout at once instead of waiting for
+// the ticker, going through the same Pre-Vote and election as a real timeout.
+// It returns once the election is decided, so tests can pick a leader
+// deterministically. Leaders ignore it.
+func (c *ConsensusModule[j, k, x]) ForceElection() {
+	c.Mutex.Lock()
+	state := c.State
+	c.Mutex.Unlock()
+	if state != Leader {
+		c.followerToCandidate()
+	}
+}
+
+// Campaign asks a follower to stand for election now instead of when its
+// election timeout expires, as a preferred leader might at startup. The
+// election goes through Pre-Vote like any other, so a node whose log is
+// behind a majority's, or that can still hear from a leader, does not
+// disturb the cluster. Leaders, candidates and learners ignore it.
+func (c *ConsensusModule[j, k, x]) Campaign() {
+	c.Mutex.Lock()
+	follower := c.State == Follower
+	c.Mutex.Unlock()
+	if follower {
+		select {
+		case c.campaign <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// campaignNow runs the election Campaign asked for, unless the node has
+// stopped being a follower in the meantime.
+func (c *ConsensusModule[j, k, x]) campaignNow() {
+	c.Mutex.Lock()
+	state := c.State
+	c.Mutex.Unlock()
+	if state == Follower {
+		c.followerToCandidate()
+	}
+}
+
+// heardFromLeader records a message from the leader of the current term that
+// passed the term and log checks. Only such a message postpones our
+// election, holds off Pre-Votes and tells clients where to go; a rejected one
+// must not, or a stale leader could keep a partition from electing a new
+// one. It expects c.Mutex to be held.
+func (c *ConsensusModule[j, k, x]) heardFromLeader(leader uint) {
+	c.setTicker()
+	c.leaderContact = c.Config.Clock.Now()
+	c.LeaderId = leader
+}
+
+// LeaderHint returns the leader of the current term as last heard from, so
+// that a node refusing a Propose can redirect the client. It reports false
+// while no leader is known, as during an election.
+func (c *ConsensusModule[j, k, x]) LeaderHint() (uint, bool) {
+	c.Mutex.Lock()
+	defer c.Mutex.Unlock()
+	return c.LeaderId, c.LeaderId != 0
+}
+
+// NotLeaderError is how the client-facing calls report ErrNotLeader, which it
+// matches with errors.Is. LeaderHint is the leader we last heard from, for
+// the caller to redirect to, or zero while none is known, as during an
+// election or a handover.
+type NotLeaderError struct {
+	LeaderHint uint
+}
+
+func (e *NotLeaderError) Error() string {
+	if e.LeaderHint == 0 {
+		return ErrNotLeader.Error()
+	}
+	return fmt.Sprintf("%v, try %d", ErrNotLeader, e.LeaderHint)
+}
+
+func (e *NotLeaderError) Is(target error) bool {
+	return target == ErrNotLeader
+}
+
+// notLeader returns the NotLeaderError for a call we cannot serve. A leader
+// refusing one, as while it hands leadership over, has no one to point to.
+// It expects c.Mutex to be held.
+func (c *ConsensusModule[j, k, x]) notLeader() error {
+	hint := c.LeaderId
+	if hint == c.Id {
+		hint = 0
+	}
+	return &NotLeaderError{LeaderHint: hint}
+}
+
+// followerCommit advances CommitIndex to min(LeaderCommit, index of the last
+// new entry) after a successful AppendEntries. It expects c.Mutex to be held.
+func (c *ConsensusModule[j, k, x]) followerCommit(entries AppendEntries[j]) {
+	lastNewIndex := entries.PrevLogIndex + Index(len(entries.Entries))
+	if lastNewIndex < 1 {
+		return
+	}
+	c.setCommitIndex(min(entries.LeaderCommit, lastNewIndex))
+}
+
+// becomeFollower adopts a newly observed term, clearing the vote cast in the
+// previous one, and steps down to follower. It expects c.Mutex to be held.
+func (c *ConsensusModule[j, k, x]) becomeFollower(term Term) {
+	if term != c.CurrentTerm {
+		c.emit(func(m Metrics) { m.TermChanged(term) })
+	}
+	c.CurrentTerm = term
+	c.VotedFor = -1
+	c.LeaderId = 0
+	c.persistState()
+	if c.State != Follower {
+		c.info("stepping down", "newTerm", term)
+		if c.State == Leader {
+			c.notifyLeadership(false)
+		}
+		c.State = Follower
+		c.setTicker()
+	}
+}
+
+// checkTimeoutNow asks the run loop for an immediate election when an accepted
+// AppendEntries carries TimeoutNow and our log ends exactly where the leader's
+// does. Lagging or diverged followers ignore it. It expects c.Mutex to be
+// held.
+func (c *ConsensusModule[j, k, x]) checkTimeoutNow(entries AppendEntries[j]) {
+	if !entries.TimeoutNow || c.State != Follower {
+		return
+	}
+	if lastIndex, _ := c.lastLog(); lastIndex != entries.PrevLogIndex+Index(len(entries.Entries)) {
+		return
+	}
+	select {
+	case c.timeoutNow <- struct{}{}:
+	default:
 	}
 }
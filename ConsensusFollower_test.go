@@ -0,0 +1,182 @@
+package raft
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestFollowerReportsLeader(t *testing.T) {
+	modules, network := newCluster(t, 3, WithPreVote(false))
+	follower := modules[2]
+	if hint, ok := follower.LeaderHint(); ok {
+		t.Errorf("fresh node hints node %d", hint)
+	}
+	follower.AppendEntry(AppendEntries[string]{Term: 2, LeaderId: 2, PrevLogIndex: 1})
+	if hint, ok := follower.LeaderHint(); !ok || hint != 2 {
+		t.Errorf("LeaderHint after a heartbeat = %d, %v; want 2, true", hint, ok)
+	}
+	var notLeader *NotLeaderError
+	if _, _, err := follower.ProposeWait(context.Background(), "SET a 1"); !errors.As(err, &notLeader) || notLeader.LeaderHint != 2 {
+		t.Errorf("ProposeWait on the follower = %v, want a redirect to node 2", err)
+	}
+
+	// Cut off, the follower's own election cannot find the leader again.
+	network.Partition([][]uint{{1, 2}, {3}})
+	follower.ForceElection()
+	if hint, ok := follower.LeaderHint(); ok {
+		t.Errorf("LeaderHint after starting an election = %d, want none", hint)
+	}
+}
+
+func TestTimeoutNow(t *testing.T) {
+	modules, network := startCluster(t, 3, quiet)
+	leader, follower, lagging := modules[0], modules[1], modules[2]
+	leader.ForceElection()
+	network.SetDropped(leader.Id, lagging.Id, true)
+	index, _, _ := leader.Propose("SET a 1")
+	waitCommitted(t, modules[:2], index)
+
+	// The lagging follower does not hold the leader's last entry, so it must
+	// not stand.
+	leader.Mutex.Lock()
+	request := leader.NewHeartbeat(follower.Id)
+	leader.Mutex.Unlock()
+	request.TimeoutNow = true
+	lagging.AppendEntry(request)
+	time.Sleep(100 * time.Millisecond)
+	if term, _, _ := lagging.GetState(); term != 1 {
+		t.Errorf("lagging follower moved to term %d on TimeoutNow", term)
+	}
+
+	started := time.Now()
+	follower.AppendEntry(request)
+	waitFor(t, "the follower to lead", func() bool {
+		return leaderOf(modules) == follower
+	})
+	if elapsed := time.Since(started); elapsed > 100*time.Millisecond {
+		t.Errorf("follower took %v to win, want under 100ms", elapsed)
+	}
+}
+
+func TestRejectedAppendDoesNotPostponeElection(t *testing.T) {
+	modules, _ := newCluster(t, 3, WithElectionTimeout(300*time.Millisecond, 350*time.Millisecond), WithPreVote(false))
+	follower := modules[2]
+	setTerm(follower, 5, -1)
+	start(t, follower)
+	// A stale leader keeps sending heartbeats far more often than the
+	// election timeout.
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		for {
+			select {
+			case <-stop:
+				return
+			case <-time.After(20 * time.Millisecond):
+				follower.AppendEntry(AppendEntries[string]{Term: 3, LeaderId: 1, PrevLogIndex: 1})
+			}
+		}
+	}()
+	started := time.Now()
+	waitFor(t, "the follower to stand", func() bool {
+		term, _, _ := follower.GetState()
+		return term > 5
+	})
+	if elapsed := time.Since(started); elapsed > 600*time.Millisecond {
+		t.Errorf("follower stood after %v, want within one election timeout", elapsed)
+	}
+}
+
+func TestCampaignWins(t *testing.T) {
+	modules, _ := startCluster(t, 3, quiet)
+	preferred := modules[2]
+	preferred.Campaign()
+	waitFor(t, "the campaigning node to lead", func() bool {
+		return leaderOf(modules) == preferred
+	})
+	term, _, _ := preferred.GetState()
+	preferred.Campaign()
+	time.Sleep(50 * time.Millisecond)
+	if now, isLeader, _ := preferred.GetState(); now != term || !isLeader {
+		t.Errorf("leader campaigning again: term %d, leader %v; want term %d, leader", now, isLeader, term)
+	}
+}
+
+func TestFollowerCannotMutateLog(t *testing.T) {
+	modules, _ := startCluster(t, 3, quiet)
+	modules[0].ForceElection()
+	follower := modules[1]
+	waitCommitted(t, modules, 2)
+	ctx, cancel := context.WithTimeout(context.Background(), waitTimeout)
+	defer cancel()
+	mutations := map[string]func() error{
+		"Propose": func() error {
+			if _, _, isLeader := follower.Propose("SET a 1"); isLeader {
+				return nil
+			}
+			return ErrNotLeader
+		},
+		"ProposeOnce": func() error {
+			if _, _, isLeader := follower.ProposeOnce(7, 1, "SET a 1"); isLeader {
+				return nil
+			}
+			return ErrNotLeader
+		},
+		"ProposeWait": func() error {
+			_, _, err := follower.ProposeWait(ctx, "SET a 1")
+			return err
+		},
+		"Barrier":      func() error { return follower.Barrier(ctx) },
+		"AddServer":    func() error { return follower.AddServer(4) },
+		"RemoveServer": func() error { return follower.RemoveServer(3) },
+	}
+	for name, mutate := range mutations {
+		last := follower.LastLogIndex()
+		if err := mutate(); !errors.Is(err, ErrNotLeader) {
+			t.Errorf("%s on a follower = %v, want ErrNotLeader", name, err)
+		}
+		if follower.LastLogIndex() != last {
+			t.Errorf("%s on a follower appended to its log", name)
+		}
+	}
+}
+
+func TestRejectionCarriesLeaderHint(t *testing.T) {
+	modules, network := startCluster(t, 3, quiet, WithPreVote(false))
+	drain(modules...)
+	modules[0].ForceElection()
+	follower := modules[1]
+	waitCommitted(t, modules, 2)
+	ctx, cancel := context.WithTimeout(context.Background(), waitTimeout)
+	defer cancel()
+	calls := map[string]func() error{
+		"ProposeWait": func() error {
+			_, _, err := follower.ProposeWait(ctx, "SET a 1")
+			return err
+		},
+		"ProposeApply": func() error {
+			_, err := follower.ProposeApply(ctx, "SET a 1")
+			return err
+		},
+		"Barrier":   func() error { return follower.Barrier(ctx) },
+		"ReadIndex": func() error { _, err := follower.ReadIndex(context.Background()); return err },
+		"LeaseRead": func() error { _, err := follower.LeaseRead(context.Background()); return err },
+	}
+	check := func(when string, hint uint) {
+		t.Helper()
+		for name, call := range calls {
+			var notLeader *NotLeaderError
+			if err := call(); !errors.As(err, &notLeader) || notLeader.LeaderHint != hint {
+				t.Errorf("%s: %s = %v, want a NotLeaderError hinting %d", when, name, err, hint)
+			}
+		}
+	}
+	check("following node 1", 1)
+
+	// Standing for election, the follower no longer knows of a leader.
+	network.Partition([][]uint{{1, 3}, {2}})
+	follower.ForceElection()
+	check("during an election", 0)
+}
@@ -0,0 +1,303 @@
+package raft
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+)
+
+// link is a one-way connection from one node to another.
+type link struct {
+	from uint
+	to   uint
+}
+
+// InMemoryNetwork routes RPCs between modules living in the same process by
+// calling their handlers directly. Links can be slowed down or cut to
+// simulate a real network.
+type InMemoryNetwork[j any, x comparable, k any] struct {
+	mutex   sync.Mutex
+	nodes   map[uint]*ConsensusModule[j, x, k]
+	order   []uint
+	latency map[link]time.Duration
+	dropped map[link]bool
+	groups  map[uint]int
+
+	// Async sends the RPCs of one fan-out in parallel instead of one after
+	// the other.
+	Async bool
+}
+
+func NewInMemoryNetwork[j any, x comparable, k any]() *InMemoryNetwork[j, x, k] {
+	return &InMemoryNetwork[j, x, k]{
+		nodes:   make(map[uint]*ConsensusModule[j, x, k]),
+		latency: make(map[link]time.Duration),
+		dropped: make(map[link]bool),
+	}
+}
+
+// NewCluster builds n modules with ids 1 to n and in-memory storage, wired
+// together through a fresh InMemoryNetwork. Every id is known to the network
+// before the first module is built, so each sees the full peer set. The
+// modules still have to be started.
+func NewCluster[j any, x comparable, k any](n int, options ...Option) ([]*ConsensusModule[j, x, k], *InMemoryNetwork[j, x, k], error) {
+	network := NewInMemoryNetwork[j, x, k]()
+	for id := uint(1); id <= uint(n); id++ {
+		network.order = append(network.order, id)
+	}
+	modules := make([]*ConsensusModule[j, x, k], 0, n)
+	for id := uint(1); id <= uint(n); id++ {
+		module, err := network.Add(id, NewMemoryStorage[j](), options...)
+		if err != nil {
+			return nil, nil, err
+		}
+		modules = append(modules, module)
+	}
+	return modules, network, nil
+}
+
+// Add builds a module with the given id on the network.
+func (n *InMemoryNetwork[j, x, k]) Add(id uint, storage Storage[j], options ...Option) (*ConsensusModule[j, x, k], error) {
+	module, err := NewConsensusModule[j, x, k](id, n.Contact(id), storage, options...)
+	if err != nil {
+		return nil, err
+	}
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	if !slices.Contains(n.order, id) {
+		n.order = append(n.order, id)
+	}
+	n.nodes[id] = module
+	return module, nil
+}
+
+// Contact returns the Contact for the node with the given id.
+func (n *InMemoryNetwork[j, x, k]) Contact(id uint) *InMemoryContact[j, x, k] {
+	return &InMemoryContact[j, x, k]{Network: n, Self: id}
+}
+
+// Node returns the module with the given id, or nil.
+func (n *InMemoryNetwork[j, x, k]) Node(id uint) *ConsensusModule[j, x, k] {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	return n.nodes[id]
+}
+
+// SetLatency delays every RPC sent from one node to another by delay.
+func (n *InMemoryNetwork[j, x, k]) SetLatency(from, to uint, delay time.Duration) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	n.latency[link{from, to}] = delay
+}
+
+// SetDropped drops, or stops dropping, every RPC sent from one node to
+// another.
+func (n *InMemoryNetwork[j, x, k]) SetDropped(from, to uint, dropped bool) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	n.dropped[link{from, to}] = dropped
+}
+
+// Partition splits the network into groups, dropping every RPC between nodes
+// in different groups. A node left out of every group is cut off from all
+// the others. It replaces any earlier partition.
+func (n *InMemoryNetwork[j, x, k]) Partition(groups [][]uint) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	n.groups = make(map[uint]int)
+	for group, ids := range groups {
+		for _, id := range ids {
+			n.groups[id] = group
+		}
+	}
+}
+
+// Heal removes the partition set by Partition. Links cut with SetDropped stay
+// cut.
+func (n *InMemoryNetwork[j, x, k]) Heal() {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	n.groups = nil
+}
+
+// separated reports whether a partition lies between two nodes. It expects
+// n.mutex to be held.
+func (n *InMemoryNetwork[j, x, k]) separated(from, to uint) bool {
+	if n.groups == nil {
+		return false
+	}
+	fromGroup, fromOk := n.groups[from]
+	toGroup, toOk := n.groups[to]
+	return !fromOk || !toOk || fromGroup != toGroup
+}
+
+// send delivers call from one node to another, reporting false if the link
+// drops it or ctx is done before the latency has passed on the receiver's
+// clock.
+func (n *InMemoryNetwork[j, x, k]) send(ctx context.Context, from, to uint, call func(*ConsensusModule[j, x, k])) bool {
+	n.mutex.Lock()
+	node, ok := n.nodes[to]
+	delay := n.latency[link{from, to}]
+	dropped := n.dropped[link{from, to}] || n.separated(from, to)
+	n.mutex.Unlock()
+	if !ok || dropped {
+		return false
+	}
+	if delay > 0 {
+		select {
+		case <-node.Config.Clock.After(delay):
+		case <-ctx.Done():
+			return false
+		}
+	}
+	call(node)
+	return true
+}
+
+// fanOut runs send for each peer, in parallel when Async is set, giving up on
+// the peers still outstanding once ctx is done.
+func (n *InMemoryNetwork[j, x, k]) fanOut(ctx context.Context, peers []uint, send func(peer uint)) {
+	if !n.Async {
+		for _, peer := range peers {
+			if ctx.Err() != nil {
+				return
+			}
+			send(peer)
+		}
+		return
+	}
+	var wg sync.WaitGroup
+	for _, peer := range peers {
+		wg.Add(1)
+		peer := peer
+		go func() {
+			defer wg.Done()
+			send(peer)
+		}()
+	}
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+	}
+}
+
+// InMemoryContact is the Contact of a single node on an InMemoryNetwork. It
+// accepts every command and reports the zero LogValue, which suits tests that
+// only exercise consensus.
+type InMemoryContact[j any, x comparable, k any] struct {
+	Network *InMemoryNetwork[j, x, k]
+	Self    uint
+}
+
+func (c *InMemoryContact[j, x, k]) GetPeerIds() []uint {
+	c.Network.mutex.Lock()
+	defer c.Network.mutex.Unlock()
+	var peers []uint
+	for _, id := range c.Network.order {
+		if id != c.Self {
+			peers = append(peers, id)
+		}
+	}
+	return peers
+}
+
+func (c *InMemoryContact[j, x, k]) GetLeader() uint {
+	c.Network.mutex.Lock()
+	nodes := make([]*ConsensusModule[j, x, k], 0, len(c.Network.order))
+	for _, id := range c.Network.order {
+		nodes = append(nodes, c.Network.nodes[id])
+	}
+	c.Network.mutex.Unlock()
+	for _, node := range nodes {
+		if _, isLeader, _ := node.GetState(); isLeader {
+			return node.Id
+		}
+	}
+	return 0
+}
+
+func (c *InMemoryContact[j, x, k]) GetLeaderLog() []LogEntry[j] {
+	return nil
+}
+
+// RequestVotes and AppendEntries collect replies until the fan-out returns;
+// replies that arrive after ctx is done are dropped.
+func (c *InMemoryContact[j, x, k]) RequestVotes(ctx context.Context, vote RequestVote[j]) map[uint]Reply {
+	var mutex sync.Mutex
+	replies := make(map[uint]Reply)
+	closed := false
+	c.Network.fanOut(ctx, c.GetPeerIds(), func(peer uint) {
+		c.Network.send(ctx, c.Self, peer, func(node *ConsensusModule[j, x, k]) {
+			reply := node.Vote(vote)
+			mutex.Lock()
+			defer mutex.Unlock()
+			if !closed {
+				replies[peer] = reply
+			}
+		})
+	})
+	mutex.Lock()
+	defer mutex.Unlock()
+	closed = true
+	return replies
+}
+
+func (c *InMemoryContact[j, x, k]) AppendEntries(ctx context.Context, entries map[uint]AppendEntries[j]) map[uint]Reply {
+	var mutex sync.Mutex
+	replies := make(map[uint]Reply, len(entries))
+	closed := false
+	peers := make([]uint, 0, len(entries))
+	for peer := range entries {
+		peers = append(peers, peer)
+	}
+	c.Network.fanOut(ctx, peers, func(peer uint) {
+		c.Network.send(ctx, c.Self, peer, func(node *ConsensusModule[j, x, k]) {
+			reply := node.AppendEntry(entries[peer])
+			mutex.Lock()
+			defer mutex.Unlock()
+			if !closed {
+				replies[peer] = reply
+			}
+		})
+	})
+	mutex.Lock()
+	defer mutex.Unlock()
+	closed = true
+	return replies
+}
+
+func (c *InMemoryContact[j, x, k]) InstallSnapshot(ctx context.Context, peer uint, snapshot InstallSnapshot) Reply {
+	var reply Reply
+	c.Network.send(ctx, c.Self, peer, func(node *ConsensusModule[j, x, k]) {
+		reply = node.InstallSnapshot(snapshot)
+	})
+	return reply
+}
+
+func (c *InMemoryContact[j, x, k]) ValidLogEntryCommand(j) bool {
+	return true
+}
+
+func (c *InMemoryContact[j, x, k]) ValidLog([]LogEntry[j]) bool {
+	return true
+}
+
+func (c *InMemoryContact[j, x, k]) ExecuteLog(uint, []j) error {
+	return nil
+}
+
+func (c *InMemoryContact[j, x, k]) DefaultLogEntryCommand() j {
+	var command j
+	return command
+}
+
+func (c *InMemoryContact[j, x, k]) LogValue([]LogEntry[j]) x {
+	var value x
+	return value
+}
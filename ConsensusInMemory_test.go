@@ -0,0 +1,281 @@
+package raft
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testModule is the module type the tests run, with string commands.
+type testModule = ConsensusModule[string, int, bool]
+
+// waitTimeout bounds every wait in the tests. Elections take a few hundred
+// milliseconds with the default timeouts, so this leaves room for several.
+const waitTimeout = 5 * time.Second
+
+// startCluster builds a cluster of n modules on an InMemoryNetwork, starts
+// them and closes them when the test ends. What they apply piles up on
+// ReceiveChan; tests that commit more than Config.BufferSize entries drain
+// it.
+func startCluster(t testing.TB, n int, options ...Option) ([]*testModule, *InMemoryNetwork[string, int, bool]) {
+	t.Helper()
+	modules, network, err := NewCluster[string, int, bool](n, options...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, module := range modules {
+		start(t, module)
+	}
+	return modules, network
+}
+
+// newCluster is startCluster without starting the modules, for tests that
+// call their handlers directly.
+func newCluster(t testing.TB, n int, options ...Option) ([]*testModule, *InMemoryNetwork[string, int, bool]) {
+	t.Helper()
+	modules, network, err := NewCluster[string, int, bool](n, options...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, module := range modules {
+		t.Cleanup(module.Close)
+	}
+	return modules, network
+}
+
+// start starts module and closes it when the test ends.
+func start(t testing.TB, module *testModule) {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(func() {
+		cancel()
+		module.Close()
+	})
+	module.Start(ctx)
+}
+
+// drain discards everything the modules deliver until they are closed.
+func drain(modules ...*testModule) {
+	for _, module := range modules {
+		go func(module *testModule) {
+			for range module.ReceiveChan {
+			}
+		}(module)
+	}
+}
+
+// waitFor polls until cond holds, failing the test with what if it does not
+// within waitTimeout.
+func waitFor(t testing.TB, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(waitTimeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// leaderOf returns the only module that believes it leads, or nil when none
+// or several do.
+func leaderOf(modules []*testModule) *testModule {
+	var leader *testModule
+	for _, module := range modules {
+		if _, isLeader, _ := module.GetState(); isLeader {
+			if leader != nil {
+				return nil
+			}
+			leader = module
+		}
+	}
+	return leader
+}
+
+// waitLeader waits until exactly one of modules leads and returns it.
+func waitLeader(t testing.TB, modules []*testModule) *testModule {
+	t.Helper()
+	var leader *testModule
+	waitFor(t, "a single leader", func() bool {
+		leader = leaderOf(modules)
+		return leader != nil
+	})
+	return leader
+}
+
+// waitCommitted waits until every module has committed index.
+func waitCommitted(t testing.TB, modules []*testModule, index Index) {
+	t.Helper()
+	waitFor(t, "the entry to commit everywhere", func() bool {
+		for _, module := range modules {
+			if module.GetCommitIndex() < index {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// receive returns the next message module delivers on ReceiveChan.
+func receive(t testing.TB, module *testModule) ApplyMsg[string] {
+	t.Helper()
+	select {
+	case msg := <-module.ReceiveChan:
+		return msg
+	case <-time.After(waitTimeout):
+		t.Fatalf("node %d delivered nothing", module.Id)
+		return ApplyMsg[string]{}
+	}
+}
+
+// sentAppend is an AppendEntries request a recordingContact sent, with the
+// reply when the peer answered.
+type sentAppend struct {
+	request  AppendEntries[string]
+	reply    Reply
+	answered bool
+}
+
+// recordingContact is an InMemoryContact that records every AppendEntries
+// request it sends, by peer, along with the most it had outstanding to each
+// peer at once.
+type recordingContact struct {
+	*InMemoryContact[string, int, bool]
+	mutex    sync.Mutex
+	sent     map[uint][]sentAppend
+	inflight map[uint]int
+	peak     map[uint]int
+}
+
+func (r *recordingContact) AppendEntries(ctx context.Context, entries map[uint]AppendEntries[string]) map[uint]Reply {
+	r.mutex.Lock()
+	for peer := range entries {
+		r.inflight[peer]++
+		r.peak[peer] = max(r.peak[peer], r.inflight[peer])
+	}
+	r.mutex.Unlock()
+	replies := r.InMemoryContact.AppendEntries(ctx, entries)
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for peer, request := range entries {
+		r.inflight[peer]--
+		reply, answered := replies[peer]
+		r.sent[peer] = append(r.sent[peer], sentAppend{request: request, reply: reply, answered: answered})
+	}
+	return replies
+}
+
+// peakInflight returns the most AppendEntries that were outstanding to peer
+// at once.
+func (r *recordingContact) peakInflight(peer uint) int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.peak[peer]
+}
+
+// appends returns what has been sent to peer so far.
+func (r *recordingContact) appends(peer uint) []sentAppend {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return slices.Clone(r.sent[peer])
+}
+
+// recordingCluster is newCluster with every module on a recordingContact.
+func recordingCluster(t testing.TB, n int, options ...Option) ([]*testModule, []*recordingContact, *InMemoryNetwork[string, int, bool]) {
+	t.Helper()
+	network := NewInMemoryNetwork[string, int, bool]()
+	for id := uint(1); id <= uint(n); id++ {
+		network.order = append(network.order, id)
+	}
+	var modules []*testModule
+	var contacts []*recordingContact
+	for id := uint(1); id <= uint(n); id++ {
+		contact := &recordingContact{
+			InMemoryContact: network.Contact(id),
+			sent:            make(map[uint][]sentAppend),
+			inflight:        make(map[uint]int),
+			peak:            make(map[uint]int),
+		}
+		module, err := NewConsensusModule[string, int, bool](id, contact, NewMemoryStorage[string](), options...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(module.Close)
+		network.mutex.Lock()
+		network.nodes[id] = module
+		network.mutex.Unlock()
+		modules = append(modules, module)
+		contacts = append(contacts, contact)
+	}
+	return modules, contacts, network
+}
+
+func TestClusterElectsLeader(t *testing.T) {
+	modules, _ := startCluster(t, 3)
+	leader := waitLeader(t, modules)
+	term, _, _ := leader.GetState()
+	waitFor(t, "every node to follow the leader", func() bool {
+		for _, module := range modules {
+			hint, _ := module.LeaderHint()
+			current, _, _ := module.GetState()
+			if module != leader && (hint != leader.Id || current != term) {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+func TestMinorityPartitionHasNoLeader(t *testing.T) {
+	modules, network := startCluster(t, 5)
+	network.Partition([][]uint{{1, 2}, {3, 4, 5}})
+	minority, majority := modules[:2], modules[2:]
+	waitLeader(t, majority)
+	// Give the minority several election timeouts to fail in.
+	time.Sleep(time.Second)
+	for _, module := range minority {
+		if _, isLeader, _ := module.GetState(); isLeader {
+			t.Errorf("node %d leads a minority partition", module.Id)
+		}
+	}
+	if leaderOf(majority) == nil {
+		t.Error("the majority lost its leader")
+	}
+
+	network.Heal()
+	waitFor(t, "the cluster to converge on one leader", func() bool {
+		leader := leaderOf(modules)
+		if leader == nil {
+			return false
+		}
+		for _, module := range modules {
+			if hint, _ := module.LeaderHint(); module != leader && hint != leader.Id {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+func TestRepliesAttributedToPeers(t *testing.T) {
+	modules, network := newCluster(t, 4)
+	setTerm(modules[2], 1, 4)
+	votes := network.Contact(1).RequestVotes(context.Background(), RequestVote[string]{Term: 1, CandidateId: 1, LastLogIndex: 1})
+	for peer, granted := range map[uint]bool{2: true, 3: false, 4: true} {
+		if reply, ok := votes[peer]; !ok || reply.VoteGranted != granted {
+			t.Errorf("vote from node %d = %v, %v, want granted %v", peer, reply, ok, granted)
+		}
+	}
+
+	// Node 3 is missing the entry the request follows.
+	appendTerms(modules[1], 1)
+	appendTerms(modules[3], 1)
+	request := AppendEntries[string]{Term: 1, LeaderId: 1, PrevLogIndex: 2, PrevLogTerm: 1}
+	replies := network.Contact(1).AppendEntries(context.Background(), map[uint]AppendEntries[string]{2: request, 3: request, 4: request})
+	for peer, success := range map[uint]bool{2: true, 3: false, 4: true} {
+		if reply, ok := replies[peer]; !ok || reply.Success != success {
+			t.Errorf("reply from node %d = %v, %v, want success %v", peer, reply, ok, success)
+		}
+	}
+}
@@ -1,6 +1,361 @@
 package raft
 
+import (
+	"maps"
+	"slices"
+	"time"
+)
+
+// handleLeader sends one round of AppendEntries. It serves the heartbeat
+// tick as well as replication requests, so every heartbeat carries whatever
+// a peer is missing and only a caught-up peer gets an empty one. Entries are
+// handed out optimistically: NextIndex moves past them as soon as they are
+// sent, so the next round can carry the following batch while this one is in
+// flight, up to Config.MaxInflight requests per peer. A peer that keeps
+// failing to answer is skipped while its backoff lasts.
 func (c *ConsensusModule[j, k, x]) handleLeader() {
-	heartbeat := c.NewHeartbeat()
-	c.Contact.AppendEntries(heartbeat)
+	peers := c.peerIds()
+	requests := make(map[uint]AppendEntries[j], len(peers))
+	var behind []uint
+	c.Mutex.Lock()
+	if c.State != Leader {
+		c.Mutex.Unlock()
+		return
+	}
+	now := c.Config.Clock.Now()
+	if c.transferring && now.After(c.transferDeadline) {
+		c.transferring = false
+	}
+	lastIndex, _ := c.lastLog()
+	for _, peer := range c.replicationTargets(peers) {
+		if now.Before(c.backoff[peer].retryAt) {
+			continue
+		}
+		if next, ok := c.NextIndex[peer]; ok && next <= c.LastIncludedIndex {
+			behind = append(behind, peer)
+			continue
+		}
+		if c.inflight[peer] >= max(c.Config.MaxInflight, 1) {
+			continue
+		}
+		request := c.newAppendEntries(peer)
+		requests[peer] = request
+		c.inflight[peer]++
+		c.NextIndex[peer] = request.PrevLogIndex + Index(len(request.Entries)) + 1
+		if c.NextIndex[peer] <= lastIndex {
+			c.notifyReplicate()
+		}
+	}
+	term := c.CurrentTerm
+	c.Mutex.Unlock()
+	start := c.Config.Clock.Now()
+	var replies map[uint]Reply
+	if len(requests) > 0 {
+		ctx, cancel := c.rpcContext(c.Config.HeartbeatIntervalMax)
+		replies = c.Contact.AppendEntries(ctx, requests)
+		cancel()
+	}
+	c.Mutex.Lock()
+	defer c.Mutex.Unlock()
+	if c.State != Leader || c.CurrentTerm != term {
+		return
+	}
+	if highest := highestTerm(replies); highest > c.CurrentTerm {
+		c.becomeFollower(highest)
+		return
+	}
+	acks := 1
+	for peer, request := range requests {
+		c.inflight[peer]--
+		reply, ok := replies[peer]
+		if !ok {
+			c.rewind(peer, request.PrevLogIndex+1)
+			c.backOff(peer)
+			continue
+		}
+		delete(c.backoff, peer)
+		c.updateProgress(peer, request, reply)
+		if reply.Term == term {
+			acks++
+			c.peerContact[peer] = start
+		}
+		lastIndex, _ := c.lastLog()
+		if c.NextIndex[peer] <= lastIndex {
+			c.notifyReplicate()
+		}
+		lag := lastIndex - min(c.MatchIndex[peer], lastIndex)
+		c.emit(func(m Metrics) { m.ReplicationLag(peer, uint(lag)) })
+	}
+	c.renewLease(start, acks, peers)
+	c.sendSnapshots(behind)
+	c.checkQuorum(peers)
+	if c.State != Leader {
+		return
+	}
+	c.advanceCommitIndex(peers)
+}
+
+// peerBackoff spaces out the AppendEntries sent to a peer that has stopped
+// answering them.
+type peerBackoff struct {
+	failures int
+	retryAt  time.Time
+}
+
+// backOff records that peer did not answer. A single miss is let go, but
+// each one after it doubles the time before peer is tried again, starting
+// from HeartbeatIntervalMin and capped at ElectionTimeoutMin so that a peer
+// coming back hears from us soon enough. The first answer clears it. It
+// expects c.Mutex to be held.
+func (c *ConsensusModule[j, k, x]) backOff(peer uint) {
+	backoff := c.backoff[peer]
+	backoff.failures++
+	if backoff.failures > 1 {
+		wait := c.Config.HeartbeatIntervalMin << min(backoff.failures-2, 16)
+		backoff.retryAt = c.Config.Clock.Now().Add(min(wait, c.Config.ElectionTimeoutMin))
+	}
+	c.backoff[peer] = backoff
+}
+
+// highestTerm returns the highest term found in replies.
+func highestTerm(replies map[uint]Reply) Term {
+	var highest Term
+	for _, reply := range replies {
+		highest = max(highest, reply.Term)
+	}
+	return highest
+}
+
+// notifyReplicate asks the run loop to send AppendEntries ahead of the next
+// heartbeat without blocking. Requests made before the loop gets round to it
+// share one round, so a burst of proposals goes out as a single batch.
+func (c *ConsensusModule[j, k, x]) notifyReplicate() {
+	select {
+	case c.replicate <- struct{}{}:
+	default:
+	}
+}
+
+// replicationTargets returns peers together with the learners and any server
+// named only by an uncommitted configuration, so that new servers catch up
+// before they count towards a majority. Targets we have no progress for yet
+// start at the end of our log. It expects c.Mutex to be held.
+func (c *ConsensusModule[j, k, x]) replicationTargets(peers []uint) []uint {
+	targets := slices.Clone(peers)
+	_, pending := c.latestConfiguration()
+	members := append(slices.Clone(c.learners), pending.Configuration...)
+	for _, member := range append(members, pending.Learners...) {
+		if member != c.Id && !slices.Contains(targets, member) {
+			targets = append(targets, member)
+		}
+	}
+	lastIndex, _ := c.lastLog()
+	for _, target := range targets {
+		if _, ok := c.NextIndex[target]; !ok {
+			c.NextIndex[target] = lastIndex + 1
+			c.MatchIndex[target] = 0
+		}
+	}
+	return targets
+}
+
+// becomeLeader takes over as leader for the current term, starting every peer
+// at the end of our log with nothing known to be replicated. It appends a
+// no-op entry in the new term, since entries left over from earlier terms
+// only commit along with one from the current term, and asserts leadership
+// by sending it at once. It expects c.Mutex to be held.
+func (c *ConsensusModule[j, k, x]) becomeLeader(peers []uint) {
+	c.State = Leader
+	c.LeaderId = c.Id
+	c.transferring = false
+	c.leaseStart = time.Time{}
+	c.NextIndex = make(map[uint]Index, len(peers))
+	c.MatchIndex = make(map[uint]Index, len(peers))
+	c.inflight = make(map[uint]int, len(peers))
+	c.peerContact = make(map[uint]time.Time, len(peers))
+	c.backoff = make(map[uint]peerBackoff, len(peers))
+	c.quorumChecked = c.Config.Clock.Now()
+	lastIndex, _ := c.lastLog()
+	for _, peer := range peers {
+		c.NextIndex[peer] = lastIndex + 1
+		c.MatchIndex[peer] = 0
+	}
+	c.setTicker()
+	c.notifyReplicate()
+	c.notifyLeadership(true)
+	id, term := c.Id, c.CurrentTerm
+	c.info("became leader")
+	c.emit(func(m Metrics) { m.LeaderElected(id, term) })
+	c.Log = append(c.Log, LogEntry[j]{Term: c.CurrentTerm, Type: NoOpEntry})
+	if c.persistLog() != nil {
+		c.Log = c.Log[:len(c.Log)-1]
+	} else if len(peers) == 0 {
+		c.advanceCommitIndex(peers)
+	}
+}
+
+// newAppendEntries builds the AppendEntries for peer, carrying the entries from
+// its NextIndex onwards, at most Config.MaxBatchSize of them. It expects
+// c.Mutex to be held.
+func (c *ConsensusModule[j, k, x]) newAppendEntries(peer uint) AppendEntries[j] {
+	request := c.NewHeartbeat(peer)
+	if position, _ := c.offset(request.PrevLogIndex + 1); position >= 0 {
+		end := len(c.Log)
+		if size := c.Config.MaxBatchSize; size > 0 && end-position > size {
+			end = position + size
+		}
+		request.Entries = slices.Clone(c.Log[position:end])
+	}
+	if lastIndex, _ := c.lastLog(); c.transferring && peer == c.transferTarget && c.MatchIndex[peer] == lastIndex {
+		request.TimeoutNow = true
+	}
+	return request
+}
+
+// TransferLeadership hands leadership to target. Proposals are refused while
+// the target is brought up to date and then told to start an election at
+// once. The transfer is abandoned if it has not happened within one maximum
+// election timeout.
+func (c *ConsensusModule[j, k, x]) TransferLeadership(target uint) error {
+	peers := c.peerIds()
+	c.Mutex.Lock()
+	defer c.Mutex.Unlock()
+	if c.State != Leader {
+		return c.notLeader()
+	}
+	if !slices.Contains(peers, target) {
+		return ErrUnknownPeer
+	}
+	c.transferring = true
+	c.transferTarget = target
+	c.transferDeadline = c.Config.Clock.Now().Add(c.Config.ElectionTimeoutMax)
+	c.notifyReplicate()
+	return nil
+}
+
+// updateProgress folds a peer's AppendEntries reply into NextIndex and
+// MatchIndex. Replies may arrive out of order, so MatchIndex only moves
+// forward. A rejection that reports a conflict skips back past the whole
+// conflicting term: to just after our own last entry of ConflictTerm if we
+// have one, otherwise to ConflictIndex. Other rejections step back to the
+// entry before the one the request was built on. It expects c.Mutex to be
+// held.
+func (c *ConsensusModule[j, k, x]) updateProgress(peer uint, request AppendEntries[j], reply Reply) {
+	if reply.Success {
+		match := request.PrevLogIndex + Index(len(request.Entries))
+		if match > c.MatchIndex[peer] {
+			c.MatchIndex[peer] = match
+		}
+		c.NextIndex[peer] = max(c.NextIndex[peer], c.MatchIndex[peer]+1)
+		return
+	}
+	next := max(request.PrevLogIndex, 1)
+	if reply.ConflictIndex > 0 {
+		next = reply.ConflictIndex
+		if last := c.lastIndexOf(reply.ConflictTerm); reply.ConflictTerm > 0 && last > 0 {
+			next = last + 1
+		}
+	}
+	c.rewind(peer, max(next, 1))
+}
+
+// rewind moves NextIndex for peer back to next, never behind what the peer is
+// known to hold. It expects c.Mutex to be held.
+func (c *ConsensusModule[j, k, x]) rewind(peer uint, next Index) {
+	if next < c.NextIndex[peer] {
+		c.NextIndex[peer] = max(next, c.MatchIndex[peer]+1)
+	}
+}
+
+// Progress reports the replication state the leader holds for peer.
+func (c *ConsensusModule[j, k, x]) Progress(peer uint) (nextIndex Index, matchIndex Index, ok bool) {
+	c.Mutex.Lock()
+	defer c.Mutex.Unlock()
+	if c.State != Leader {
+		return 0, 0, false
+	}
+	nextIndex, ok = c.NextIndex[peer]
+	return nextIndex, c.MatchIndex[peer], ok
+}
+
+// LeaderStatus reports, while we are leader, the MatchIndex of every peer
+// being replicated to along with our CommitIndex and last log index, all
+// read at the same instant, so that a caller can show how far each follower
+// lags.
+func (c *ConsensusModule[j, k, x]) LeaderStatus() (matchIndex map[uint]Index, commitIndex Index, lastLogIndex Index, ok bool) {
+	c.Mutex.Lock()
+	defer c.Mutex.Unlock()
+	if c.State != Leader {
+		return nil, 0, 0, false
+	}
+	lastIndex, _ := c.lastLog()
+	return maps.Clone(c.MatchIndex), c.CommitIndex, lastIndex, true
+}
+
+// ClusterHealth reports how many voting peers have answered the leader
+// within the minimum election timeout, whether they and the leader together
+// still make a majority, and the leader we know of. A leader cut off from
+// its majority carries on until it hears of a higher term, so hasQuorum
+// turning false is what gives such a partition away. Only the leader tracks
+// reachability; on any other node reachable is zero and hasQuorum false.
+func (c *ConsensusModule[j, k, x]) ClusterHealth() (reachable int, hasQuorum bool, leaderId uint) {
+	peers := c.peerIds()
+	c.Mutex.Lock()
+	defer c.Mutex.Unlock()
+	if c.State != Leader {
+		return 0, false, c.LeaderId
+	}
+	reachable = c.reachable(peers, c.Config.Clock.Now())
+	return reachable, reachable+1 >= quorum(peers), c.Id
+}
+
+// reachable counts the peers that answered an AppendEntries sent within the
+// minimum election timeout before now. It expects c.Mutex to be held.
+func (c *ConsensusModule[j, k, x]) reachable(peers []uint, now time.Time) int {
+	count := 0
+	for _, peer := range peers {
+		if contact, ok := c.peerContact[peer]; ok && now.Sub(contact) < c.Config.ElectionTimeoutMin {
+			count++
+		}
+	}
+	return count
+}
+
+// checkQuorum steps down to follower when Config.CheckQuorum is set and,
+// once a minimum election timeout has passed since becoming leader or the
+// last check, fewer than a majority have answered within it. The term and
+// our vote in it are kept. It expects c.Mutex to be held.
+func (c *ConsensusModule[j, k, x]) checkQuorum(peers []uint) {
+	now := c.Config.Clock.Now()
+	if !c.Config.CheckQuorum || now.Sub(c.quorumChecked) < c.Config.ElectionTimeoutMin {
+		return
+	}
+	c.quorumChecked = now
+	if c.reachable(peers, now)+1 >= quorum(peers) {
+		return
+	}
+	c.warn("lost contact with a majority, stepping down")
+	c.LeaderId = 0
+	c.State = Follower
+	c.notifyLeadership(false)
+	c.setTicker()
+}
+
+// advanceCommitIndex moves CommitIndex up to the highest index stored on a
+// majority of the cluster, counting our own log. Only an entry from the
+// current term is committed by counting replicas; earlier entries are
+// committed along with it. It expects c.Mutex to be held.
+func (c *ConsensusModule[j, k, x]) advanceCommitIndex(peers []uint) {
+	matched := make([]Index, 0, len(peers)+1)
+	lastIndex, _ := c.lastLog()
+	matched = append(matched, lastIndex)
+	for _, peer := range peers {
+		matched = append(matched, c.MatchIndex[peer])
+	}
+	slices.Sort(matched)
+	index := matched[len(matched)-quorum(peers)]
+	if c.termAt(index) != c.CurrentTerm {
+		return
+	}
+	c.setCommitIndex(index)
 }
@@ -0,0 +1,600 @@
+package raft
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+)
+
+// emptyLog clears the log every module starts with, as if nothing had ever
+// been written.
+func emptyLog(modules ...*testModule) {
+	for _, module := range modules {
+		module.Mutex.Lock()
+		module.Log = nil
+		module.CommitIndex, module.LastApplied = 0, 0
+		module.Mutex.Unlock()
+	}
+}
+
+func TestHeartbeatWithEmptyLog(t *testing.T) {
+	modules, _, err := NewCluster[string, int, bool](3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	emptyLog(modules...)
+	leader := modules[0]
+	leader.Mutex.Lock()
+	heartbeat := leader.NewHeartbeat(2)
+	leader.Mutex.Unlock()
+	if heartbeat.PrevLogIndex != 0 || heartbeat.PrevLogTerm != 0 {
+		t.Errorf("heartbeat follows index %d in term %d, want 0 and 0", heartbeat.PrevLogIndex, heartbeat.PrevLogTerm)
+	}
+
+	for _, module := range modules {
+		start(t, module)
+	}
+	leader = waitLeader(t, modules)
+	// The leader's no-op is the first entry, and committing it everywhere
+	// takes heartbeats sent while the followers' logs were empty.
+	waitCommitted(t, modules, 1)
+	if entry, err := leader.Get(1); err != nil || entry.Type != NoOpEntry {
+		t.Errorf("Get(1) = %v, %v, want the leader's no-op", entry, err)
+	}
+}
+
+func TestLaggingFollowerBacksOff(t *testing.T) {
+	modules, contacts, _ := recordingCluster(t, 3, quiet)
+	leader, lagging := modules[0], modules[1]
+	// The lagging follower led terms 2 and 3 without committing anything,
+	// so the leader has to walk back past both before the logs match.
+	appendTerms(leader, 1, 1, 1, 4, 4)
+	appendTerms(modules[2], 1, 1, 1, 4, 4)
+	appendTerms(lagging, 1, 2, 3, 3)
+	setTerm(leader, 4, -1)
+	setTerm(modules[2], 4, -1)
+	setTerm(lagging, 3, -1)
+	for _, module := range modules {
+		start(t, module)
+	}
+	leader.ForceElection()
+	if _, isLeader, _ := leader.GetState(); !isLeader {
+		t.Fatal("node 1 was not elected")
+	}
+
+	want := []Term{0, 1, 1, 1, 4, 4, 5}
+	waitFor(t, "the lagging follower to catch up", func() bool {
+		return slices.Equal(logTerms(lagging), want)
+	})
+	rejected := 0
+	for _, sent := range contacts[0].appends(lagging.Id) {
+		if sent.answered && !sent.reply.Success {
+			rejected++
+		}
+	}
+	if rejected < 2 {
+		t.Errorf("caught up after %d rejected requests, want several", rejected)
+	}
+	waitFor(t, "the leader to see the follower's progress", func() bool {
+		next, match, ok := leader.Progress(lagging.Id)
+		return ok && next == 8 && match == 7
+	})
+}
+
+func TestNewHeartbeatPrevEntry(t *testing.T) {
+	tests := []struct {
+		name      string
+		log       []LogEntry[string]
+		next      Index
+		prevIndex Index
+		prevTerm  Term
+	}{
+		{name: "empty log", prevIndex: 0, prevTerm: 0},
+		{name: "empty log, peer at the start", next: 1, prevIndex: 0, prevTerm: 0},
+		{name: "single entry", log: []LogEntry[string]{{Term: 3}}, prevIndex: 1, prevTerm: 3},
+		{name: "single entry, peer missing it", log: []LogEntry[string]{{Term: 3}}, next: 1, prevIndex: 0, prevTerm: 0},
+		{name: "single entry, peer holding it", log: []LogEntry[string]{{Term: 3}}, next: 2, prevIndex: 1, prevTerm: 3},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			modules, _ := newCluster(t, 3)
+			leader := modules[0]
+			emptyLog(leader)
+			leader.Mutex.Lock()
+			defer leader.Mutex.Unlock()
+			leader.Log = test.log
+			leader.NextIndex = make(map[uint]Index)
+			if test.next != 0 {
+				leader.NextIndex[2] = test.next
+			}
+			heartbeat := leader.NewHeartbeat(2)
+			if heartbeat.PrevLogIndex != test.prevIndex || heartbeat.PrevLogTerm != test.prevTerm {
+				t.Errorf("heartbeat follows index %d in term %d, want %d and %d", heartbeat.PrevLogIndex, heartbeat.PrevLogTerm, test.prevIndex, test.prevTerm)
+			}
+		})
+	}
+}
+
+func TestTransferLeadership(t *testing.T) {
+	modules, _ := startCluster(t, 3, quiet)
+	leader, target := modules[0], modules[2]
+	leader.ForceElection()
+	if err := modules[1].TransferLeadership(target.Id); !errors.Is(err, ErrNotLeader) {
+		t.Errorf("TransferLeadership on a follower = %v, want ErrNotLeader", err)
+	}
+	if err := leader.TransferLeadership(9); !errors.Is(err, ErrUnknownPeer) {
+		t.Errorf("TransferLeadership to node 9 = %v, want ErrUnknownPeer", err)
+	}
+
+	leader.Propose("SET a 1")
+	started := time.Now()
+	if err := leader.TransferLeadership(target.Id); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the target to lead", func() bool {
+		return leaderOf(modules) == target
+	})
+	// The election timeout never fires in this cluster, so only the transfer
+	// can have elected the target; it should not take a whole election cycle.
+	if elapsed := time.Since(started); elapsed > 450*time.Millisecond {
+		t.Errorf("transfer took %v, want under 450ms", elapsed)
+	}
+	if term, _, _ := target.GetState(); term != 2 {
+		t.Errorf("target leads term %d, want 2", term)
+	}
+}
+
+// carrying counts the AppendEntries sent to peer that carried entries.
+func carrying(contact *recordingContact, peer uint) (requests, entries int) {
+	for _, sent := range contact.appends(peer) {
+		if len(sent.request.Entries) > 0 {
+			requests++
+			entries = max(entries, len(sent.request.Entries))
+		}
+	}
+	return requests, entries
+}
+
+func TestProposalsAreBatched(t *testing.T) {
+	modules, contacts, _ := recordingCluster(t, 3, quiet, WithMaxBatchSize(16))
+	for _, module := range modules {
+		start(t, module)
+	}
+	drain(modules...)
+	leader := modules[0]
+	leader.ForceElection()
+	waitCommitted(t, modules, 2)
+	before, _ := carrying(contacts[0], 2)
+
+	const proposals = 200
+	var index Index
+	for i := 0; i < proposals; i++ {
+		index, _, _ = leader.Propose(fmt.Sprintf("SET k %d", i))
+	}
+	waitCommitted(t, modules, index)
+	requests, largest := carrying(contacts[0], 2)
+	if requests-before >= proposals {
+		t.Errorf("%d proposals took %d AppendEntries, want fewer", proposals, requests-before)
+	}
+	if largest > 16 {
+		t.Errorf("an AppendEntries carried %d entries, more than MaxBatchSize", largest)
+	}
+}
+
+func BenchmarkPropose(b *testing.B) {
+	modules, contacts, _ := recordingCluster(b, 3, quiet)
+	for _, module := range modules {
+		start(b, module)
+	}
+	drain(modules...)
+	leader := modules[0]
+	leader.ForceElection()
+	waitCommitted(b, modules, 2)
+	before, _ := carrying(contacts[0], 2)
+
+	b.ResetTimer()
+	var index Index
+	for i := 0; i < b.N; i++ {
+		index, _, _ = leader.Propose("SET k v")
+	}
+	waitCommitted(b, modules, index)
+	b.StopTimer()
+	requests, _ := carrying(contacts[0], 2)
+	b.ReportMetric(float64(requests-before)/float64(b.N), "appends/op")
+}
+
+// BenchmarkPipelining replicates over links with a millisecond of latency,
+// in small batches so that throughput depends on how many requests a peer
+// can have in flight.
+func BenchmarkPipelining(b *testing.B) {
+	for name, inflight := range map[string]int{"lock-step": 1, "pipelined": 4} {
+		b.Run(name, func(b *testing.B) {
+			modules, network := startCluster(b, 3, quiet, WithMaxBatchSize(4), WithMaxInflight(inflight))
+			network.Async = true
+			for _, peer := range modules[1:] {
+				network.SetLatency(modules[0].Id, peer.Id, time.Millisecond)
+			}
+			drain(modules...)
+			leader := modules[0]
+			leader.ForceElection()
+			waitCommitted(b, modules, 2)
+
+			b.ResetTimer()
+			var index Index
+			for i := 0; i < b.N; i++ {
+				index, _, _ = leader.Propose("SET k v")
+			}
+			waitCommitted(b, modules, index)
+		})
+	}
+}
+
+// repeat returns n copies of term.
+func repeat(term Term, n int) []Term {
+	terms := make([]Term, n)
+	for i := range terms {
+		terms[i] = term
+	}
+	return terms
+}
+
+func TestDivergedFollowerCatchesUpByTerm(t *testing.T) {
+	modules, contacts, _ := recordingCluster(t, 3, quiet)
+	leader, diverged := modules[0], modules[1]
+	// The diverged follower holds 200 entries the leader never had, in two
+	// terms, so stepping back one entry per rejection would take 200 rounds.
+	// Skipping a term at a time takes one for the end of its log and one
+	// for each of its terms, give or take requests already in flight.
+	leaderLog := append([]Term{1}, repeat(4, 250)...)
+	appendTerms(leader, leaderLog...)
+	appendTerms(modules[2], leaderLog...)
+	appendTerms(diverged, append(append([]Term{1}, repeat(2, 100)...), repeat(3, 100)...)...)
+	setTerm(leader, 4, -1)
+	setTerm(modules[2], 4, -1)
+	setTerm(diverged, 3, -1)
+	for _, module := range modules {
+		start(t, module)
+	}
+	leader.ForceElection()
+	if _, isLeader, _ := leader.GetState(); !isLeader {
+		t.Fatal("node 1 was not elected")
+	}
+
+	want := logTerms(leader)
+	waitFor(t, "the diverged follower to catch up", func() bool {
+		return slices.Equal(logTerms(diverged), want)
+	})
+	rejected := 0
+	for _, sent := range contacts[0].appends(diverged.Id) {
+		if sent.answered && !sent.reply.Success {
+			rejected++
+		}
+	}
+	if rejected > 10 {
+		t.Errorf("caught up after %d rejected requests, want a few", rejected)
+	}
+}
+
+// TestFigure8 replays Figure 8 of the Raft paper, one entry later since
+// every log here starts with an entry at index 1. Node 1 leads term 4 with
+// the entry at index 3 from term 2 on a majority, while node 5 holds another
+// entry at index 3 from term 3 and could still be elected by nodes 2 to 4
+// and overwrite it. So index 3 must not be committed until an entry of term
+// 4 on a majority commits it along with everything before.
+func TestFigure8(t *testing.T) {
+	modules, _ := newCluster(t, 5)
+	leader := modules[0]
+	appendTerms(leader, 1, 2)
+	peers := leader.peerIds()
+	leader.Mutex.Lock()
+	defer leader.Mutex.Unlock()
+	leader.CurrentTerm = 4
+	leader.State = Leader
+	leader.CommitIndex = 2
+	leader.MatchIndex = map[uint]Index{2: 3, 3: 3, 4: 2, 5: 2}
+	leader.advanceCommitIndex(peers)
+	if leader.CommitIndex != 2 {
+		t.Fatalf("committed through %d on a majority holding an entry of term 2, want 2", leader.CommitIndex)
+	}
+
+	leader.Log = append(leader.Log, LogEntry[string]{Term: 4, Command: "SET"})
+	leader.MatchIndex[2], leader.MatchIndex[3] = 4, 4
+	leader.advanceCommitIndex(peers)
+	if leader.CommitIndex != 4 {
+		t.Errorf("committed through %d once an entry of term 4 is on a majority, want 4", leader.CommitIndex)
+	}
+}
+
+func TestStaleLeaderStepsDown(t *testing.T) {
+	modules, _ := startCluster(t, 3, quiet)
+	leader := modules[0]
+	leader.ForceElection()
+	// The others have moved on to term 5 without the leader hearing of it,
+	// as after a partition.
+	setTerm(modules[1], 5, -1)
+	setTerm(modules[2], 5, -1)
+	waitFor(t, "the stale leader to step down", func() bool {
+		term, isLeader, _ := leader.GetState()
+		return !isLeader && term == 5
+	})
+}
+
+func TestLeaderStatusShowsLag(t *testing.T) {
+	modules, network := startCluster(t, 3, quiet)
+	leader, lagging := modules[0], modules[2]
+	if _, _, _, ok := leader.LeaderStatus(); ok {
+		t.Error("LeaderStatus reported ok on a follower")
+	}
+	leader.ForceElection()
+	network.SetDropped(leader.Id, lagging.Id, true)
+	var index Index
+	for i := 0; i < 5; i++ {
+		index, _, _ = leader.Propose(fmt.Sprintf("SET k %d", i))
+	}
+	waitCommitted(t, modules[:2], index)
+	waitFor(t, "the leader to see node 2 caught up", func() bool {
+		matchIndex, _, _, _ := leader.LeaderStatus()
+		return matchIndex[2] == index
+	})
+
+	matchIndex, commitIndex, lastLogIndex, ok := leader.LeaderStatus()
+	if !ok {
+		t.Fatal("LeaderStatus reported not ok on the leader")
+	}
+	if commitIndex != index || lastLogIndex != index {
+		t.Errorf("commit index %d and last log index %d, want %d", commitIndex, lastLogIndex, index)
+	}
+	if matchIndex[lagging.Id] >= lastLogIndex {
+		t.Errorf("lagging follower matched through %d, want behind %d", matchIndex[lagging.Id], lastLogIndex)
+	}
+}
+
+func TestHeartbeatCarriesProposal(t *testing.T) {
+	modules, contacts, _ := recordingCluster(t, 3, quiet)
+	leader := modules[0]
+	// Nothing is started, so entries leave the leader only on the heartbeats
+	// the test sends.
+	leader.ForceElection()
+	leader.handleLeader()
+	index, _, _ := leader.Propose("SET a 1")
+	for _, follower := range modules[1:] {
+		if last := follower.LastLogIndex(); last >= index {
+			t.Fatalf("node %d holds index %d before any heartbeat", follower.Id, last)
+		}
+	}
+
+	leader.handleLeader()
+	for _, follower := range modules[1:] {
+		sent := contacts[0].appends(follower.Id)
+		request := sent[len(sent)-1].request
+		if n := len(request.Entries); n == 0 || request.Entries[n-1].Command != "SET a 1" {
+			t.Errorf("heartbeat to node %d carried %v, want the proposal", follower.Id, request.Entries)
+		}
+		if entry, err := follower.Get(index); err != nil || entry.Command != "SET a 1" {
+			t.Errorf("node %d: Get(%d) = %v, %v; want the proposal", follower.Id, index, entry, err)
+		}
+	}
+
+	leader.handleLeader()
+	for _, follower := range modules[1:] {
+		sent := contacts[0].appends(follower.Id)
+		if entries := sent[len(sent)-1].request.Entries; len(entries) != 0 {
+			t.Errorf("heartbeat to caught-up node %d carried %v", follower.Id, entries)
+		}
+	}
+}
+
+func TestInflightBounded(t *testing.T) {
+	const bound = 2
+	modules, contacts, network := recordingCluster(t, 3, quiet, WithMaxBatchSize(1), WithMaxInflight(bound))
+	network.Async = true
+	leader, slow := modules[0], modules[2]
+	network.SetLatency(leader.Id, slow.Id, 10*time.Millisecond)
+	for _, module := range modules {
+		start(t, module)
+	}
+	drain(modules...)
+	leader.ForceElection()
+
+	var index Index
+	for i := 0; i < 50; i++ {
+		index, _, _ = leader.Propose(fmt.Sprintf("SET k %d", i))
+	}
+	waitCommitted(t, modules, index)
+	if peak := contacts[0].peakInflight(slow.Id); peak > bound {
+		t.Errorf("%d AppendEntries outstanding to the slow follower, want at most %d", peak, bound)
+	}
+}
+
+// clockedLeader builds a cluster of three unstarted modules on clock with a
+// fixed election timeout of a second and elects node 1, which has heard from
+// both followers by the time it returns.
+func clockedLeader(t *testing.T, clock *ManualClock, options ...Option) ([]*testModule, *InMemoryNetwork[string, int, bool]) {
+	t.Helper()
+	options = append([]Option{WithClock(clock), WithElectionTimeout(time.Second, time.Second)}, options...)
+	modules, network := newCluster(t, 3, options...)
+	modules[0].ForceElection()
+	modules[0].handleLeader()
+	return modules, network
+}
+
+func TestClusterHealthLosesQuorum(t *testing.T) {
+	clock := NewManualClock(time.Unix(0, 0))
+	modules, network := clockedLeader(t, clock)
+	leader := modules[0]
+	if reachable, hasQuorum, leaderId := leader.ClusterHealth(); reachable != 2 || !hasQuorum || leaderId != 1 {
+		t.Errorf("ClusterHealth = %d, %v, %d; want 2, true, 1", reachable, hasQuorum, leaderId)
+	}
+	if _, hasQuorum, leaderId := modules[1].ClusterHealth(); hasQuorum || leaderId != 1 {
+		t.Errorf("follower's ClusterHealth = %v, %d; want false, 1", hasQuorum, leaderId)
+	}
+
+	network.Partition([][]uint{{1}, {2, 3}})
+	clock.Advance(time.Second)
+	leader.handleLeader()
+	if reachable, hasQuorum, leaderId := leader.ClusterHealth(); reachable != 0 || hasQuorum || leaderId != 1 {
+		t.Errorf("ClusterHealth when cut off = %d, %v, %d; want 0, false, 1", reachable, hasQuorum, leaderId)
+	}
+}
+
+func TestCheckQuorumStepsDown(t *testing.T) {
+	for _, enabled := range []bool{true, false} {
+		clock := NewManualClock(time.Unix(0, 0))
+		modules, network := clockedLeader(t, clock, WithCheckQuorum(enabled))
+		leader := modules[0]
+		network.Partition([][]uint{{1}, {2, 3}})
+		clock.Advance(500 * time.Millisecond)
+		leader.handleLeader()
+		if _, isLeader, _ := leader.GetState(); !isLeader {
+			t.Fatalf("CheckQuorum %v: leader stepped down before an election timeout passed", enabled)
+		}
+		clock.Advance(500 * time.Millisecond)
+		leader.handleLeader()
+		if term, isLeader, _ := leader.GetState(); isLeader == enabled || term != 1 {
+			t.Errorf("CheckQuorum %v: after an election timeout cut off, term %d, leader %v", enabled, term, isLeader)
+		}
+	}
+}
+
+func TestFarBehindFollowerCatchesUpInChunks(t *testing.T) {
+	const behind, batch = 3000, 64
+	modules, contacts, _ := recordingCluster(t, 3, quiet, WithMaxAppendEntries(batch))
+	leader, lagging := modules[0], modules[1]
+	if size := leader.Config.MaxBatchSize; size != batch {
+		t.Fatalf("MaxBatchSize = %d after WithMaxAppendEntries(%d)", size, batch)
+	}
+	appendTerms(leader, repeat(1, behind)...)
+	appendTerms(modules[2], repeat(1, behind)...)
+	setTerm(leader, 1, -1)
+	setTerm(modules[2], 1, -1)
+	for _, module := range modules {
+		start(t, module)
+	}
+	drain(modules...)
+	leader.ForceElection()
+	waitFor(t, "the lagging follower to catch up", func() bool {
+		return lagging.LastLogIndex() == leader.LastLogIndex()
+	})
+	requests, largest := carrying(contacts[0], lagging.Id)
+	if largest > batch {
+		t.Errorf("an AppendEntries carried %d entries, more than MaxAppendEntries", largest)
+	}
+	if requests < behind/batch {
+		t.Errorf("%d entries arrived in %d AppendEntries, want at least %d", behind, requests, behind/batch)
+	}
+}
+
+func TestPriorTermEntryCommitsWithNoOp(t *testing.T) {
+	modules, _ := newCluster(t, 3, quiet)
+	leader := modules[0]
+	// A majority holds the entry from term 1, but its leader went down
+	// before committing it.
+	appendTerms(leader, 1)
+	appendTerms(modules[1], 1)
+	for _, module := range modules {
+		setTerm(module, 1, -1)
+	}
+	leader.ForceElection()
+	if entry, err := leader.Get(3); err != nil || entry.Type != NoOpEntry || entry.Term != 2 {
+		t.Fatalf("Get(3) = %v, %v; want the new leader's no-op", entry, err)
+	}
+	if commit := leader.GetCommitIndex(); commit != 1 {
+		t.Fatalf("commit index %d before the no-op replicated, want 1", commit)
+	}
+	leader.handleLeader()
+	if commit := leader.GetCommitIndex(); commit != 3 {
+		t.Errorf("commit index %d once the no-op replicated, want 3", commit)
+	}
+
+	// The application sees the entry from term 1 but not the no-op.
+	start(t, leader)
+	if msg := receive(t, leader); msg.Index != 2 || msg.Command != "SET" {
+		t.Errorf("delivered %+v, want the entry at 2", msg)
+	}
+	select {
+	case msg := <-leader.ReceiveChan:
+		t.Errorf("delivered %+v after the entry at 2", msg)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestFarAheadLeaderUsesConflictHint(t *testing.T) {
+	modules, contacts, _ := recordingCluster(t, 3, quiet, WithMaxInflight(1))
+	leader, short := modules[0], modules[1]
+	appendTerms(leader, repeat(1, 500)...)
+	appendTerms(modules[2], repeat(1, 500)...)
+	setTerm(leader, 1, -1)
+	setTerm(modules[2], 1, -1)
+	for _, module := range modules {
+		start(t, module)
+	}
+	drain(modules...)
+	leader.ForceElection()
+	waitFor(t, "the short follower to catch up", func() bool {
+		return short.LastLogIndex() == leader.LastLogIndex()
+	})
+	var rejected []sentAppend
+	for _, sent := range contacts[0].appends(short.Id) {
+		if sent.answered && !sent.reply.Success {
+			rejected = append(rejected, sent)
+		}
+	}
+	// The first refusal points at the end of the follower's log, so the
+	// leader never walks back through the 500 entries it is missing.
+	if len(rejected) != 1 || rejected[0].reply.ConflictIndex != 2 {
+		t.Errorf("refused %d times, first with %+v; want one refusal pointing at 2", len(rejected), rejected)
+	}
+}
+
+func TestFlappingPeerBackoff(t *testing.T) {
+	clock := NewManualClock(time.Unix(0, 0))
+	modules, network := clockedLeader(t, clock, WithHeartbeatInterval(50*time.Millisecond, 50*time.Millisecond))
+	leader, flapping := modules[0], modules[2]
+	// retry returns how long the leader now waits before trying the
+	// flapping peer again, and whether it is backing off at all.
+	retry := func() (time.Duration, bool) {
+		leader.Mutex.Lock()
+		defer leader.Mutex.Unlock()
+		backoff, ok := leader.backoff[flapping.Id]
+		if !ok || backoff.retryAt.IsZero() {
+			return 0, ok
+		}
+		return backoff.retryAt.Sub(clock.Now()), true
+	}
+	live := func() {
+		t.Helper()
+		leader.Mutex.Lock()
+		defer leader.Mutex.Unlock()
+		if _, ok := leader.backoff[modules[1].Id]; ok {
+			t.Fatal("the live peer is being backed off")
+		}
+	}
+
+	for flap := 0; flap < 2; flap++ {
+		network.SetDropped(leader.Id, flapping.Id, true)
+		var waits []time.Duration
+		for len(waits) < 8 {
+			leader.handleLeader()
+			live()
+			wait, _ := retry()
+			waits = append(waits, wait)
+			clock.Advance(max(wait, 50*time.Millisecond))
+		}
+		want := []time.Duration{0, 50, 100, 200, 400, 800, 1000, 1000}
+		for i := range want {
+			want[i] *= time.Millisecond
+		}
+		if !slices.Equal(waits, want) {
+			t.Errorf("flap %d: waits %v, want %v", flap, waits, want)
+		}
+
+		// The first answer clears the backoff.
+		network.SetDropped(leader.Id, flapping.Id, false)
+		leader.handleLeader()
+		if wait, backingOff := retry(); backingOff {
+			t.Errorf("flap %d: still waiting %v once the peer answered", flap, wait)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package raft
+
+import "context"
+
+// LeaderChanges returns a channel that receives true each time this module
+// becomes leader and false each time it stops being leader, in the order the
+// transitions happen. Transitions are queued from the first call on, so none
+// is dropped however slowly the channel is read. The channel is closed by
+// Close.
+func (c *ConsensusModule[j, x, k]) LeaderChanges() <-chan bool {
+	c.Mutex.Lock()
+	defer c.Mutex.Unlock()
+	c.watchingLeadership = true
+	return c.leaderChanges
+}
+
+// notifyLeadership queues a leadership transition for the leadership loop
+// once LeaderChanges has been called, and wakes any Barrier waiting on
+// c.applied so that it sees the change. It expects c.Mutex to be held.
+func (c *ConsensusModule[j, x, k]) notifyLeadership(leader bool) {
+	c.applied.Broadcast()
+	if !c.watchingLeadership {
+		return
+	}
+	c.leadershipEvents = append(c.leadershipEvents, leader)
+	select {
+	case c.leadershipNotify <- struct{}{}:
+	default:
+	}
+}
+
+// leadershipLoop delivers queued transitions on leaderChanges until ctx is
+// cancelled.
+func (c *ConsensusModule[j, x, k]) leadershipLoop(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-c.leadershipNotify:
+		}
+		c.Mutex.Lock()
+		events := c.leadershipEvents
+		c.leadershipEvents = nil
+		c.Mutex.Unlock()
+		for _, leader := range events {
+			select {
+			case <-ctx.Done():
+				return
+			case c.leaderChanges <- leader:
+			}
+		}
+	}
+}
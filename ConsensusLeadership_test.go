@@ -0,0 +1,30 @@
+package raft
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLeaderChangesFollowTransitions(t *testing.T) {
+	modules, _ := startCluster(t, 3, quiet)
+	changes := modules[0].LeaderChanges()
+	// Node 1 wins, loses its leadership to node 2 and wins it back.
+	modules[0].ForceElection()
+	modules[1].ForceElection()
+	modules[0].ForceElection()
+	for i, want := range []bool{true, false, true} {
+		select {
+		case leader := <-changes:
+			if leader != want {
+				t.Fatalf("notification %d = %v, want %v", i, leader, want)
+			}
+		case <-time.After(waitTimeout):
+			t.Fatalf("notification %d never arrived", i)
+		}
+	}
+	select {
+	case leader := <-changes:
+		t.Errorf("unexpected notification %v", leader)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
@@ -0,0 +1,49 @@
+package raft
+
+// Logger receives leveled, structured log lines: a message followed by
+// alternating keys and values. A *slog.Logger satisfies it. Methods may be
+// called with c.Mutex held and must not call back into the module.
+type Logger interface {
+	Debug(msg string, fields ...any)
+	Info(msg string, fields ...any)
+	Warn(msg string, fields ...any)
+}
+
+// NoopLogger is the Logger used when none is configured.
+type NoopLogger struct{}
+
+func (NoopLogger) Debug(string, ...any) {}
+func (NoopLogger) Info(string, ...any)  {}
+func (NoopLogger) Warn(string, ...any)  {}
+
+func (s ConsensusModuleState) String() string {
+	switch s {
+	case Follower:
+		return "follower"
+	case Candidate:
+		return "candidate"
+	case Leader:
+		return "leader"
+	}
+	return "unknown"
+}
+
+// fields prefixes fields with our id, term and state. It expects c.Mutex to
+// be held.
+func (c *ConsensusModule[j, x, k]) fields(fields []any) []any {
+	return append([]any{"id", c.Id, "term", c.CurrentTerm, "state", c.State}, fields...)
+}
+
+// debug, info and warn log through Config.Logger. They expect c.Mutex to be
+// held.
+func (c *ConsensusModule[j, x, k]) debug(msg string, fields ...any) {
+	c.Config.Logger.Debug(msg, c.fields(fields)...)
+}
+
+func (c *ConsensusModule[j, x, k]) info(msg string, fields ...any) {
+	c.Config.Logger.Info(msg, c.fields(fields)...)
+}
+
+func (c *ConsensusModule[j, x, k]) warn(msg string, fields ...any) {
+	c.Config.Logger.Warn(msg, c.fields(fields)...)
+}
@@ -0,0 +1,39 @@
+package raft
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+)
+
+// captureLogger keeps every line logged to it, formatted as the level, the
+// message and the fields.
+type captureLogger struct {
+	mutex sync.Mutex
+	lines []string
+}
+
+func (l *captureLogger) log(level, msg string, fields []any) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.lines = append(l.lines, fmt.Sprintf("%s %s %v", level, msg, fields))
+}
+
+func (l *captureLogger) Debug(msg string, fields ...any) { l.log("DEBUG", msg, fields) }
+func (l *captureLogger) Info(msg string, fields ...any)  { l.log("INFO", msg, fields) }
+func (l *captureLogger) Warn(msg string, fields ...any)  { l.log("WARN", msg, fields) }
+
+func TestVoteGrantedIsLogged(t *testing.T) {
+	logger := new(captureLogger)
+	modules, _ := newCluster(t, 3, WithLogger(logger))
+	if reply := modules[0].Vote(RequestVote[string]{Term: 1, CandidateId: 2, LastLogIndex: 1}); !reply.VoteGranted {
+		t.Fatal("vote refused")
+	}
+	logger.mutex.Lock()
+	defer logger.mutex.Unlock()
+	want := "INFO granted vote [id 1 term 1 state follower candidate 2]"
+	if !slices.Contains(logger.lines, want) {
+		t.Errorf("logged %q, want a line %q", logger.lines, want)
+	}
+}
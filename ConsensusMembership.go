@@ -0,0 +1,290 @@
+package raft
+
+import (
+	"fmt"
+	"slices"
+)
+
+// ConfChangeType is the kind of membership change a ConfChange makes.
+type ConfChangeType int
+
+const (
+	ConfChangeAddVoter ConfChangeType = iota
+	ConfChangeAddLearner
+	ConfChangePromoteLearner
+	ConfChangeRemove
+)
+
+// ConfChange is a membership change to the server Id, as proposed through
+// ProposeConfChange.
+type ConfChange struct {
+	Type ConfChangeType
+	Id   uint
+}
+
+// ProposeConfChange proposes change as a configuration entry, which is kept
+// apart from commands and takes effect for membership once it commits. It is
+// AddServer, AddLearner, PromoteLearner or RemoveServer depending on
+// change.Type, failing as they do, including with ErrConfigurationChange
+// while another change has yet to commit.
+func (c *ConsensusModule[j, x, k]) ProposeConfChange(change ConfChange) error {
+	switch change.Type {
+	case ConfChangeAddVoter:
+		return c.AddServer(change.Id)
+	case ConfChangeAddLearner:
+		return c.AddLearner(change.Id)
+	case ConfChangePromoteLearner:
+		return c.PromoteLearner(change.Id)
+	case ConfChangeRemove:
+		return c.RemoveServer(change.Id)
+	}
+	return fmt.Errorf("%w: %d", ErrConfChangeType, change.Type)
+}
+
+// AddServer proposes a configuration with id added as a voter. Only one
+// change may be in flight at a time, and the new configuration governs
+// elections and commitment once its entry has committed.
+func (c *ConsensusModule[j, x, k]) AddServer(id uint) error {
+	return c.changeConfiguration(func(voters, learners []uint) ([]uint, []uint, error) {
+		if slices.Contains(voters, id) || slices.Contains(learners, id) {
+			return nil, nil, ErrAlreadyMember
+		}
+		return append(voters, id), learners, nil
+	})
+}
+
+// AddLearner proposes a configuration with id added as a learner. Learners
+// are sent the log and apply it like any follower, but are left out of
+// elections and of the majority that commits entries, so a new server can
+// catch up without slowing the cluster down.
+func (c *ConsensusModule[j, x, k]) AddLearner(id uint) error {
+	return c.changeConfiguration(func(voters, learners []uint) ([]uint, []uint, error) {
+		if slices.Contains(voters, id) || slices.Contains(learners, id) {
+			return nil, nil, ErrAlreadyMember
+		}
+		return voters, append(learners, id), nil
+	})
+}
+
+// PromoteLearner proposes a configuration that turns the learner id into a
+// voter. It is refused with ErrLearnerBehind until the learner holds every
+// committed entry.
+func (c *ConsensusModule[j, x, k]) PromoteLearner(id uint) error {
+	return c.changeConfiguration(func(voters, learners []uint) ([]uint, []uint, error) {
+		if !slices.Contains(learners, id) {
+			return nil, nil, ErrUnknownPeer
+		}
+		if c.MatchIndex[id] < c.CommitIndex {
+			return nil, nil, ErrLearnerBehind
+		}
+		return append(voters, id), without(learners, id), nil
+	})
+}
+
+// RemoveServer proposes a configuration without id, which may be a voter or
+// a learner. A leader that removes itself steps down once the change commits.
+func (c *ConsensusModule[j, x, k]) RemoveServer(id uint) error {
+	return c.changeConfiguration(func(voters, learners []uint) ([]uint, []uint, error) {
+		if !slices.Contains(voters, id) && !slices.Contains(learners, id) {
+			return nil, nil, ErrUnknownPeer
+		}
+		return without(voters, id), without(learners, id), nil
+	})
+}
+
+// Configuration returns the voters, ourselves included when we are one, and
+// the learners of the committed configuration, so a membership change shows
+// up here only once its entry has committed. Until the first one does, the
+// voters are the peers from Contact.GetPeerIds along with us, unless
+// Config.Learner is set.
+func (c *ConsensusModule[j, x, k]) Configuration() (voters []uint, learners []uint) {
+	peers := c.peerIds()
+	c.Mutex.Lock()
+	defer c.Mutex.Unlock()
+	if c.configuration != nil {
+		return slices.Clone(c.configuration), slices.Clone(c.learners)
+	}
+	if c.isMember() {
+		peers = append(peers, c.Id)
+		slices.Sort(peers)
+	}
+	return peers, slices.Clone(c.learners)
+}
+
+// Bootstrap makes members, which must include us, the first configuration of
+// a brand-new cluster by writing it as the entry at index 1, which every node
+// starts out with committed. Call it once on each initial member, with the
+// same members, before Start, so that they all agree on that entry; AddServer
+// and the rest then work from the first election on. A node that already has
+// a term, a vote, entries or a snapshot is refused with ErrNotFresh.
+func (c *ConsensusModule[j, x, k]) Bootstrap(members []uint) error {
+	c.Mutex.Lock()
+	defer c.Mutex.Unlock()
+	fresh := c.CurrentTerm == 0 && c.VotedFor == -1 && c.LastIncludedIndex == 0
+	if !fresh || len(c.Log) != 1 || c.Log[0].Type != CommandEntry {
+		return ErrNotFresh
+	}
+	if !slices.Contains(members, c.Id) {
+		return fmt.Errorf("%w: %d", ErrNotMember, c.Id)
+	}
+	voters := slices.Clone(members)
+	slices.Sort(voters)
+	voters = slices.Compact(voters)
+	log := c.Log
+	c.Log = []LogEntry[j]{{Type: ConfigurationEntry, Configuration: voters}}
+	if err := c.persistLog(); err != nil {
+		c.Log = log
+		return err
+	}
+	c.restoreConfiguration()
+	return nil
+}
+
+// restoreConfiguration adopts the newest configuration entry among those
+// already counted as committed, as when the log is restored, since
+// setCommitIndex only sees the ones it newly commits. It expects c.Mutex to
+// be held.
+func (c *ConsensusModule[j, x, k]) restoreConfiguration() {
+	for i := c.LastIncludedIndex + 1; i <= c.CommitIndex; i++ {
+		if entry, ok := c.entryAt(i); ok && entry.Type == ConfigurationEntry {
+			c.configuration = slices.Clone(entry.Configuration)
+			c.learners = slices.Clone(entry.Learners)
+		}
+	}
+}
+
+func (c *ConsensusModule[j, x, k]) changeConfiguration(change func(voters, learners []uint) ([]uint, []uint, error)) error {
+	members := append(c.peerIds(), c.Id)
+	c.Mutex.Lock()
+	defer c.Mutex.Unlock()
+	if c.State != Leader {
+		return c.notLeader()
+	}
+	if index, _ := c.latestConfiguration(); index > c.CommitIndex {
+		return ErrConfigurationChange
+	}
+	learners := slices.Clone(c.learners)
+	voters := slices.DeleteFunc(members, func(member uint) bool {
+		return slices.Contains(learners, member)
+	})
+	voters, learners, err := change(voters, learners)
+	if err != nil {
+		return err
+	}
+	slices.Sort(voters)
+	slices.Sort(learners)
+	c.Log = append(c.Log, LogEntry[j]{
+		Term:          c.CurrentTerm,
+		Type:          ConfigurationEntry,
+		Configuration: voters,
+		Learners:      learners,
+	})
+	if err := c.persistLog(); err != nil {
+		c.Log = c.Log[:len(c.Log)-1]
+		return err
+	}
+	c.notifyReplicate()
+	return nil
+}
+
+// without returns ids with id left out.
+func without(ids []uint, id uint) []uint {
+	return slices.DeleteFunc(slices.Clone(ids), func(member uint) bool {
+		return member == id
+	})
+}
+
+// peerIds returns the voters other than us from the committed configuration,
+// or from Contact.GetPeerIds while no configuration has committed yet. It must
+// be called without c.Mutex held.
+func (c *ConsensusModule[j, x, k]) peerIds() []uint {
+	c.Mutex.Lock()
+	configuration := c.configuration
+	c.Mutex.Unlock()
+	if configuration == nil {
+		return normalizePeers(c.Id, c.Contact.GetPeerIds())
+	}
+	return normalizePeers(c.Id, configuration)
+}
+
+// normalizePeers returns a sorted copy of peers with duplicates and id
+// removed, so that a sloppy peer list cannot skew the quorum.
+func normalizePeers(id uint, peers []uint) []uint {
+	peers = slices.Clone(peers)
+	slices.Sort(peers)
+	return slices.DeleteFunc(slices.Compact(peers), func(peer uint) bool {
+		return peer == id
+	})
+}
+
+// validatePeers checks the peer set a module is constructed with, which must
+// not include id. An empty set makes a single-node cluster.
+func validatePeers(id uint, peers []uint) error {
+	if slices.Contains(peers, id) {
+		return fmt.Errorf("%w: %d", ErrSelfPeer, id)
+	}
+	return nil
+}
+
+// quorum returns how many votes make a majority of a cluster made of peers
+// and ourselves.
+func quorum(peers []uint) int {
+	return (len(peers)+1)/2 + 1
+}
+
+// latestConfiguration returns the newest configuration entry still held in
+// the log, committed or not, and its index. It expects c.Mutex to be held.
+func (c *ConsensusModule[j, x, k]) latestConfiguration() (Index, LogEntry[j]) {
+	for position := len(c.Log) - 1; position >= 0; position-- {
+		if c.Log[position].Type == ConfigurationEntry {
+			return c.LastIncludedIndex + Index(position) + 1, c.Log[position]
+		}
+	}
+	return 0, LogEntry[j]{}
+}
+
+// configurationAt returns the voters and learners as of index, which the
+// application may snapshot at before later configuration entries: the newest
+// configuration entry up to index, or the snapshot's when the log holds none.
+// It expects c.Mutex to be held.
+func (c *ConsensusModule[j, x, k]) configurationAt(index Index) (voters, learners []uint) {
+	for i := index; i > c.LastIncludedIndex; i-- {
+		if entry, ok := c.entryAt(i); ok && entry.Type == ConfigurationEntry {
+			return slices.Clone(entry.Configuration), slices.Clone(entry.Learners)
+		}
+	}
+	return c.snapshotConfiguration, c.snapshotLearners
+}
+
+// isMember reports whether we are a voter in the committed configuration.
+// Until one commits, a module started with Config.Learner is not. It expects
+// c.Mutex to be held.
+func (c *ConsensusModule[j, x, k]) isMember() bool {
+	if c.configuration == nil {
+		return !c.Config.Learner
+	}
+	return slices.Contains(c.configuration, c.Id)
+}
+
+// setCommitIndex advances CommitIndex to index, adopting any configuration
+// entries it newly commits. It expects c.Mutex to be held.
+func (c *ConsensusModule[j, x, k]) setCommitIndex(index Index) {
+	if index <= c.CommitIndex {
+		return
+	}
+	for i := c.CommitIndex + 1; i <= index; i++ {
+		if entry, ok := c.entryAt(i); ok && entry.Type == ConfigurationEntry {
+			c.configuration = slices.Clone(entry.Configuration)
+			c.learners = slices.Clone(entry.Learners)
+		}
+	}
+	c.CommitIndex = index
+	c.notifyApply()
+	c.emit(func(m Metrics) { m.EntryCommitted(index) })
+	if c.State == Leader && !c.isMember() {
+		c.State = Follower
+		c.LeaderId = 0
+		c.setTicker()
+		c.notifyLeadership(false)
+	}
+}
@@ -0,0 +1,290 @@
+package raft
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+)
+
+// bootstrapped builds and starts nodes 1 to n with a bootstrapped
+// configuration of all of them, so later changes come from the log alone.
+func bootstrapped(t *testing.T, n int, options ...Option) ([]*testModule, *InMemoryNetwork[string, int, bool]) {
+	t.Helper()
+	network := NewInMemoryNetwork[string, int, bool]()
+	var members []uint
+	for id := uint(1); id <= uint(n); id++ {
+		members = append(members, id)
+	}
+	var modules []*testModule
+	for _, id := range members {
+		module, err := network.Add(id, NewMemoryStorage[string](), options...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := module.Bootstrap(members); err != nil {
+			t.Fatal(err)
+		}
+		modules = append(modules, module)
+	}
+	for _, module := range modules {
+		start(t, module)
+	}
+	return modules, network
+}
+
+// waitConfiguration waits until every module has committed a configuration
+// of voters.
+func waitConfiguration(t *testing.T, modules []*testModule, voters ...uint) {
+	t.Helper()
+	waitFor(t, "the configuration to commit everywhere", func() bool {
+		for _, module := range modules {
+			if got, _ := module.Configuration(); !slices.Equal(got, voters) {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+func TestGrowAndShrinkCluster(t *testing.T) {
+	modules, network := bootstrapped(t, 3)
+	leader := waitLeader(t, modules)
+	for _, id := range []uint{4, 5} {
+		module, err := network.Add(id, NewMemoryStorage[string]())
+		if err != nil {
+			t.Fatal(err)
+		}
+		start(t, module)
+		// The new server is only a voter once the change has committed.
+		if voters, _ := leader.Configuration(); slices.Contains(voters, id) {
+			t.Fatalf("node %d counted as a voter before being added", id)
+		}
+		if err := leader.AddServer(id); err != nil {
+			t.Fatal(err)
+		}
+		modules = append(modules, module)
+		waitConfiguration(t, modules, idsOf(modules)...)
+	}
+	index, _, isLeader := leader.Propose("SET grown 1")
+	if !isLeader {
+		t.Fatal("the leader lost leadership while growing the cluster")
+	}
+	waitCommitted(t, modules, index)
+
+	if err := leader.RemoveServer(5); err != nil {
+		t.Fatal(err)
+	}
+	waitConfiguration(t, modules[:4], 1, 2, 3, 4)
+	if err := leader.RemoveServer(4); err != nil {
+		t.Fatal(err)
+	}
+	waitConfiguration(t, modules[:3], 1, 2, 3)
+	// Two of the three remaining voters are a majority now, as they would
+	// not be of five.
+	survivors := []*testModule{leader}
+	for _, module := range modules {
+		switch {
+		case module == leader:
+		case len(survivors) < 2:
+			survivors = append(survivors, module)
+		default:
+			module.Close()
+		}
+	}
+	index, _, isLeader = leader.Propose("SET shrunk 1")
+	if !isLeader {
+		t.Fatal("the leader lost leadership while shrinking the cluster")
+	}
+	waitCommitted(t, survivors, index)
+}
+
+// idsOf returns the ids of modules.
+func idsOf(modules []*testModule) []uint {
+	ids := make([]uint, len(modules))
+	for i, module := range modules {
+		ids[i] = module.Id
+	}
+	return ids
+}
+
+func TestQuorum(t *testing.T) {
+	for size, want := range map[int]int{1: 1, 2: 2, 3: 2, 4: 3, 5: 3, 6: 4, 7: 4} {
+		peers := make([]uint, size-1)
+		if got := quorum(peers); got != want {
+			t.Errorf("quorum of %d nodes = %d, want %d", size, got, want)
+		}
+	}
+}
+
+func TestPeerValidation(t *testing.T) {
+	newModule := func(peers ...uint) (*testModule, error) {
+		module, err := NewConsensusModule[string, int, bool](1, &fakeContact{peers: peers}, NewMemoryStorage[string](), quiet, WithPreVote(false))
+		if err == nil {
+			t.Cleanup(module.Close)
+		}
+		return module, err
+	}
+
+	if _, err := newModule(1, 2, 3); !errors.Is(err, ErrSelfPeer) {
+		t.Errorf("peers including ourselves: %v, want ErrSelfPeer", err)
+	}
+
+	module, err := newModule(3, 2, 3, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if peers := module.peerIds(); !slices.Equal(peers, []uint{2, 3}) {
+		t.Errorf("duplicated peers counted as %v, want [2 3]", peers)
+	}
+	// Counting every listed peer would make a cluster of five, which one
+	// vote besides our own could not win.
+	module.Contact.(*fakeContact).votes = map[uint]Reply{2: {Term: 1, VoteGranted: true}}
+	module.startElection()
+	if _, isLeader, _ := module.GetState(); !isLeader {
+		t.Error("not elected by one of two distinct peers")
+	}
+
+	module, err = newModule()
+	if err != nil {
+		t.Fatal(err)
+	}
+	module.startElection()
+	if _, isLeader, _ := module.GetState(); !isLeader {
+		t.Error("a node without peers did not elect itself")
+	}
+}
+
+func TestLearnerCatchesUpThenPromoted(t *testing.T) {
+	modules, network := bootstrapped(t, 3)
+	leader := waitLeader(t, modules)
+	var index Index
+	for i := 0; i < 20; i++ {
+		index, _, _ = leader.Propose(fmt.Sprintf("SET k %d", i))
+	}
+	waitCommitted(t, modules, index)
+	term, _, _ := leader.GetState()
+
+	learner, err := network.Add(4, NewMemoryStorage[string](), WithLearner())
+	if err != nil {
+		t.Fatal(err)
+	}
+	start(t, learner)
+	drain(append(modules, learner)...)
+	if err := leader.AddLearner(learner.Id); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the learner to catch up", func() bool {
+		return learner.GetCommitIndex() >= index
+	})
+	if voters, learners := leader.Configuration(); !slices.Equal(voters, []uint{1, 2, 3}) || !slices.Equal(learners, []uint{4}) {
+		t.Errorf("configuration %v with learners %v, want [1 2 3] with learner 4", voters, learners)
+	}
+
+	waitFor(t, "the learner to be promoted", func() bool {
+		return leader.PromoteLearner(learner.Id) == nil
+	})
+	waitConfiguration(t, append(modules, learner), 1, 2, 3, 4)
+	if current, _, _ := leader.GetState(); current != term {
+		t.Errorf("leader moved from term %d to %d while the learner caught up", term, current)
+	}
+}
+
+func TestConfigurationShowsOnlyCommitted(t *testing.T) {
+	modules, network := bootstrapped(t, 3, quiet)
+	drain(modules...)
+	leader := modules[0]
+	leader.ForceElection()
+	waitConfiguration(t, modules, 1, 2, 3)
+	added, err := network.Add(4, NewMemoryStorage[string]())
+	if err != nil {
+		t.Fatal(err)
+	}
+	start(t, added)
+	drain(added)
+
+	// With the other voters cut off, the change is in the leader's log but
+	// cannot commit.
+	network.Partition([][]uint{{1, 4}, {2, 3}})
+	last := leader.LastLogIndex()
+	if err := leader.AddServer(4); err != nil {
+		t.Fatal(err)
+	}
+	if leader.LastLogIndex() == last {
+		t.Fatal("AddServer appended nothing")
+	}
+	time.Sleep(100 * time.Millisecond)
+	if voters, _ := leader.Configuration(); slices.Contains(voters, 4) {
+		t.Errorf("voters %v include node 4 before the change committed", voters)
+	}
+
+	network.Heal()
+	waitConfiguration(t, append(modules, added), 1, 2, 3, 4)
+}
+
+func TestBootstrapThenElect(t *testing.T) {
+	modules, _ := bootstrapped(t, 3)
+	drain(modules...)
+	leader := waitLeader(t, modules)
+	for _, module := range modules {
+		entry, err := module.Get(1)
+		if err != nil || entry.Type != ConfigurationEntry || !slices.Equal(entry.Configuration, []uint{1, 2, 3}) {
+			t.Errorf("node %d: Get(1) = %+v, %v; want the bootstrap configuration", module.Id, entry, err)
+		}
+	}
+	index, _, isLeader := leader.Propose("SET a 1")
+	if !isLeader {
+		t.Fatal("the leader refused a proposal")
+	}
+	waitCommitted(t, modules, index)
+
+	// Every node now has state, so none can be bootstrapped again.
+	for _, module := range modules {
+		if err := module.Bootstrap([]uint{1, 2, 3}); !errors.Is(err, ErrNotFresh) {
+			t.Errorf("node %d: second Bootstrap = %v, want ErrNotFresh", module.Id, err)
+		}
+	}
+	fresh, _ := newCluster(t, 3)
+	setTerm(fresh[0], 1, -1)
+	if err := fresh[0].Bootstrap([]uint{1, 2, 3}); !errors.Is(err, ErrNotFresh) {
+		t.Errorf("Bootstrap of a node with a term = %v, want ErrNotFresh", err)
+	}
+	if err := fresh[1].Bootstrap([]uint{1, 3}); !errors.Is(err, ErrNotMember) {
+		t.Errorf("Bootstrap leaving the node out = %v, want ErrNotMember", err)
+	}
+}
+
+func TestProposeConfChange(t *testing.T) {
+	modules, network := bootstrapped(t, 3, quiet)
+	drain(modules...)
+	leader := modules[0]
+	leader.ForceElection()
+	added, err := network.Add(4, NewMemoryStorage[string]())
+	if err != nil {
+		t.Fatal(err)
+	}
+	start(t, added)
+	drain(added)
+	if err := leader.ProposeConfChange(ConfChange{Type: ConfChangeType(9), Id: 4}); !errors.Is(err, ErrConfChangeType) {
+		t.Errorf("ProposeConfChange of an unknown type = %v, want ErrConfChangeType", err)
+	}
+
+	// Held back from committing, the change keeps a second one out.
+	network.Partition([][]uint{{1, 4}, {2, 3}})
+	if err := leader.ProposeConfChange(ConfChange{Type: ConfChangeAddVoter, Id: 4}); err != nil {
+		t.Fatal(err)
+	}
+	if entry, err := leader.Get(leader.LastLogIndex()); err != nil || entry.Type != ConfigurationEntry {
+		t.Errorf("last entry %+v, %v; want a configuration entry", entry, err)
+	}
+	if err := leader.ProposeConfChange(ConfChange{Type: ConfChangeAddLearner, Id: 5}); !errors.Is(err, ErrConfigurationChange) {
+		t.Errorf("a second change in flight = %v, want ErrConfigurationChange", err)
+	}
+
+	network.Heal()
+	waitConfiguration(t, append(modules, added), 1, 2, 3, 4)
+	if err := leader.ProposeConfChange(ConfChange{Type: ConfChangeAddLearner, Id: 5}); err != nil {
+		t.Errorf("a change after the first committed = %v", err)
+	}
+}
@@ -0,0 +1,78 @@
+package raft
+
+import "context"
+
+// maxQueuedEvents caps the events waiting for the metrics loop, so a Metrics
+// that cannot keep up loses events rather than holding on to ever more.
+const maxQueuedEvents = 1024
+
+// Metrics receives events from a ConsensusModule for monitoring. Calls are
+// made from a single goroutine, in the order the events happened, and never
+// while c.Mutex is held, so implementations may block briefly or call back
+// into the module.
+type Metrics interface {
+	ElectionStarted(term Term)
+	ElectionWon(term Term)
+	ElectionLost(term Term)
+	TermChanged(term Term)
+	LeaderElected(leader uint, term Term)
+	EntryCommitted(index Index)
+	ReplicationLag(peer uint, entries uint)
+}
+
+// NoopMetrics is the Metrics used when none is configured.
+type NoopMetrics struct{}
+
+func (NoopMetrics) ElectionStarted(Term)      {}
+func (NoopMetrics) ElectionWon(Term)          {}
+func (NoopMetrics) ElectionLost(Term)         {}
+func (NoopMetrics) TermChanged(Term)          {}
+func (NoopMetrics) LeaderElected(uint, Term)  {}
+func (NoopMetrics) EntryCommitted(Index)      {}
+func (NoopMetrics) ReplicationLag(uint, uint) {}
+
+// emit queues event for the metrics loop unless no Metrics is configured.
+// Events are dropped while the loop is not running, before Start or after
+// Close, and while maxQueuedEvents are already waiting. It expects c.Mutex
+// to be held.
+func (c *ConsensusModule[j, x, k]) emit(event func(Metrics)) {
+	if _, noop := c.Config.Metrics.(NoopMetrics); noop || c.Config.Metrics == nil {
+		return
+	}
+	if c.metricsLoops == 0 || len(c.events) >= maxQueuedEvents {
+		return
+	}
+	c.events = append(c.events, event)
+	select {
+	case c.metricsNotify <- struct{}{}:
+	default:
+	}
+}
+
+// metricsLoop hands queued events to Config.Metrics until ctx is cancelled.
+// begin has already counted it in c.metricsLoops; the last loop to stop
+// drops whatever is still queued.
+func (c *ConsensusModule[j, x, k]) metricsLoop(ctx context.Context) {
+	defer func() {
+		c.Mutex.Lock()
+		c.metricsLoops--
+		if c.metricsLoops == 0 {
+			c.events = nil
+		}
+		c.Mutex.Unlock()
+	}()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-c.metricsNotify:
+		}
+		c.Mutex.Lock()
+		events := c.events
+		c.events = nil
+		c.Mutex.Unlock()
+		for _, event := range events {
+			event(c.Config.Metrics)
+		}
+	}
+}
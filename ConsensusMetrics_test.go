@@ -0,0 +1,110 @@
+package raft
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+)
+
+// recordingMetrics is a Metrics that records every event as a line such as
+// "elected 1 1", leaving replication lag out as it is reported on every
+// heartbeat.
+type recordingMetrics struct {
+	mutex  sync.Mutex
+	events []string
+}
+
+func (r *recordingMetrics) record(format string, args ...any) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.events = append(r.events, fmt.Sprintf(format, args...))
+}
+
+func (r *recordingMetrics) recorded() []string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return slices.Clone(r.events)
+}
+
+func (r *recordingMetrics) ElectionStarted(term Term) { r.record("started %d", term) }
+func (r *recordingMetrics) ElectionWon(term Term)     { r.record("won %d", term) }
+func (r *recordingMetrics) ElectionLost(term Term)    { r.record("lost %d", term) }
+func (r *recordingMetrics) TermChanged(term Term)     { r.record("term %d", term) }
+func (r *recordingMetrics) LeaderElected(leader uint, term Term) {
+	r.record("elected %d %d", leader, term)
+}
+func (r *recordingMetrics) EntryCommitted(index Index) { r.record("committed %d", index) }
+func (r *recordingMetrics) ReplicationLag(uint, uint)  {}
+
+func TestMetricsElectionSequence(t *testing.T) {
+	metrics := &recordingMetrics{}
+	modules, _ := startCluster(t, 1, WithMetrics(metrics))
+	waitLeader(t, modules)
+	// The single node's own vote commits the no-op it appends on election.
+	want := []string{"term 1", "started 1", "elected 1 1", "committed 2", "won 1"}
+	waitFor(t, "the election's metrics", func() bool {
+		return len(metrics.recorded()) >= len(want)
+	})
+	if got := metrics.recorded()[:len(want)]; !slices.Equal(got, want) {
+		t.Fatalf("metrics = %q, want %q", got, want)
+	}
+}
+
+func TestMetricsNotQueuedWithoutLoop(t *testing.T) {
+	metrics := &recordingMetrics{}
+	module, err := NewInMemoryNetwork[string, int, bool]().Add(1, NewMemoryStorage[string](), WithMetrics(metrics))
+	if err != nil {
+		t.Fatal(err)
+	}
+	emit := func() int {
+		module.Mutex.Lock()
+		defer module.Mutex.Unlock()
+		for i := 0; i < 2*maxQueuedEvents; i++ {
+			module.emit(func(m Metrics) { m.TermChanged(1) })
+		}
+		return len(module.events)
+	}
+	if queued := emit(); queued != 0 {
+		t.Errorf("%d events queued before Start", queued)
+	}
+	start(t, module)
+	waitLeader(t, []*testModule{module})
+	module.Close()
+	if queued := emit(); queued != 0 {
+		t.Errorf("%d events queued after Close", queued)
+	}
+}
+
+// blockingMetrics is a Metrics whose first TermChanged blocks until release
+// is closed, standing in for one that cannot keep up.
+type blockingMetrics struct {
+	NoopMetrics
+	once    sync.Once
+	blocked chan struct{}
+	release chan struct{}
+}
+
+func (b *blockingMetrics) TermChanged(Term) {
+	b.once.Do(func() {
+		close(b.blocked)
+		<-b.release
+	})
+}
+
+func TestMetricsQueueBounded(t *testing.T) {
+	metrics := &blockingMetrics{blocked: make(chan struct{}), release: make(chan struct{})}
+	modules, _ := startCluster(t, 1, WithMetrics(metrics))
+	module := modules[0]
+	defer close(metrics.release)
+	<-metrics.blocked
+
+	module.Mutex.Lock()
+	defer module.Mutex.Unlock()
+	for i := 0; i < 2*maxQueuedEvents; i++ {
+		module.emit(func(m Metrics) { m.EntryCommitted(1) })
+	}
+	if queued := len(module.events); queued > maxQueuedEvents {
+		t.Errorf("%d events queued, want at most %d", queued, maxQueuedEvents)
+	}
+}
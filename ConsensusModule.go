@@ -1,20 +1,47 @@
 package raft
 
-import (
-	"fmt"
-	"time"
-)
-
+// Vote handles a RequestVote or a Pre-Vote from a candidate. With
+// Config.LeaderStickiness, a vote is refused without looking at its term
+// while we lead or have recently heard from a leader, unless it is for a
+// leadership transfer.
 func (c *ConsensusModule[j, x, k]) Vote(request RequestVote[j]) Reply {
-	if c.VotedFor == -1 && request.Term >= c.CurrentTerm {
-		nodeLastLogLen, nodeLastLogTerm := c.lastLog()
-		if (request.LastLogIndex == nodeLastLogLen && nodeLastLogTerm == request.LastLogTerm) || request.LastLogIndex > nodeLastLogLen {
-			c.VotedFor = int(request.CandidateId)
+	c.Mutex.Lock()
+	defer c.Mutex.Unlock()
+	if request.Term < c.CurrentTerm {
+		return Reply{
+			Term:        c.CurrentTerm,
+			VoteGranted: false,
+		}
+	}
+	if request.PreVote {
+		return Reply{
+			Term:        c.CurrentTerm,
+			VoteGranted: c.grantPreVote(request),
+		}
+	}
+	if c.Config.LeaderStickiness && !request.LeadershipTransfer && (c.State == Leader || c.leaderActive()) {
+		return Reply{
+			Term:        c.CurrentTerm,
+			VoteGranted: false,
+		}
+	}
+	if request.Term > c.CurrentTerm {
+		c.becomeFollower(request.Term)
+	}
+	if c.VotedFor == -1 && c.logUpToDate(request.LastLogIndex, request.LastLogTerm) {
+		c.VotedFor = int(request.CandidateId)
+		if c.persistState() != nil {
+			c.VotedFor = -1
 			return Reply{
 				Term:        c.CurrentTerm,
-				VoteGranted: true,
+				VoteGranted: false,
 			}
 		}
+		c.info("granted vote", "candidate", request.CandidateId)
+		return Reply{
+			Term:        c.CurrentTerm,
+			VoteGranted: true,
+		}
 	}
 	return Reply{
 		Term:        c.CurrentTerm,
@@ -22,50 +49,173 @@ func (c *ConsensusModule[j, x, k]) Vote(request RequestVote[j]) Reply {
 	}
 }
 
+// AppendEntry handles an AppendEntries from a leader. One from an earlier term
+// is refused with our term so that its stale sender steps down; one from our
+// term or a later one makes us a follower of its sender, adopting a later
+// term before anything else in the request is looked at. A retransmitted
+// request changes nothing: entries we already hold are not written again and
+// the commit index never moves back.
 func (c *ConsensusModule[j, x, k]) AppendEntry(entries AppendEntries[j]) Reply {
-	lastIndex, lastLog := c.lastLog()
 	ll := c.Contact.GetLeaderLog()
+	c.Mutex.Lock()
+	defer c.Mutex.Unlock()
+	if entries.Term < c.CurrentTerm {
+		return Reply{
+			Term:    c.CurrentTerm,
+			Success: false,
+		}
+	}
+	if entries.Term > c.CurrentTerm {
+		c.becomeFollower(entries.Term)
+	} else if c.State == Candidate {
+		c.State = Follower
+		c.setTicker()
+	}
+	if !c.prevLogMatches(entries.PrevLogIndex, entries.PrevLogTerm) {
+		conflictIndex, conflictTerm := c.conflict(entries.PrevLogIndex)
+		return Reply{
+			Term:          c.CurrentTerm,
+			Success:       false,
+			ConflictIndex: conflictIndex,
+			ConflictTerm:  conflictTerm,
+		}
+	}
 	c.Contact.LogValue(ll)
 	c.Contact.LogValue(c.Log)
-	if entries.Term >= c.CurrentTerm && len(entries.Entries) == 0 && entries.PrevLogIndex == lastIndex && entries.PrevLogTerm == lastLog && c.Contact.ValidLog(ll) && c.Contact.LogValue(ll) == c.Contact.LogValue(c.Log) {
-		c.CurrentTerm = entries.Term
-		c.VotedFor = -1
-		c.SetTicker()
+	if len(entries.Entries) == 0 && c.Contact.ValidLog(ll) && c.Contact.LogValue(ll) == c.Contact.LogValue(c.Log) {
+		c.heardFromLeader(entries.LeaderId)
+		c.followerCommit(entries)
+		c.checkTimeoutNow(entries)
 		return Reply{
-			Term:        c.CurrentTerm,
-			VoteGranted: true,
+			Term:    c.CurrentTerm,
+			Success: true,
+		}
+	} else if len(entries.Entries) > 0 {
+		if !termsOrdered(entries) {
+			c.warn("rejected entries with out of order terms", "leader", entries.LeaderId)
+			return Reply{
+				Term:    c.CurrentTerm,
+				Success: false,
+			}
 		}
-	} else if len(entries.Entries) > 0 && (entries.PrevLogIndex == lastIndex && entries.PrevLogTerm == lastLog) {
 		for _, entry := range entries.Entries {
-			if !c.Contact.ValidLogEntryCommand(entry.Command) {
-				fmt.Println("Not valid command")
+			if entry.Type == CommandEntry && !c.Contact.ValidLogEntryCommand(entry.Command) {
+				c.warn("rejected invalid command", "leader", entries.LeaderId)
 				return Reply{
-					Term:        c.CurrentTerm,
-					VoteGranted: false,
+					Term:    c.CurrentTerm,
+					Success: false,
 				}
 			}
 		}
-		c.Log = append(c.Log, entries.Entries...)
-		if c.State != Leader && ll != nil && len(ll) != len(c.Log) {
-			// Need to add proper getting of missing logs
-			c.Log = ll
+		changed := c.mergeEntries(entries.PrevLogIndex, entries.Entries)
+		if (changed || c.logUnsaved) && c.persistLog() != nil {
+			return Reply{
+				Term:    c.CurrentTerm,
+				Success: false,
+			}
 		}
-		fmt.Println(c.Id, "Log updated")
+		c.heardFromLeader(entries.LeaderId)
+		c.followerCommit(entries)
+		c.checkTimeoutNow(entries)
+		c.debug("appended entries", "leader", entries.LeaderId, "prevLogIndex", entries.PrevLogIndex, "count", len(entries.Entries))
 		return Reply{
-			Term:        c.CurrentTerm,
-			VoteGranted: true,
+			Term:    c.CurrentTerm,
+			Success: true,
 		}
 	}
 	return Reply{
-		Term:        c.CurrentTerm,
-		VoteGranted: false,
+		Term:    c.CurrentTerm,
+		Success: false,
 	}
 }
 
+// Propose appends command to the log when this node is leader and starts
+// replicating it, returning the index and term it was assigned. Followers and
+// candidates return isLeader false so the caller can redirect to LeaderHint,
+// as does a leader that is transferring leadership or fails to persist the
+// entry. A node without peers is its own majority and commits the entry at
+// once. Concurrent calls are appended one at a time under the mutex, so each
+// is given its own index with none skipped.
+func (c *ConsensusModule[j, x, k]) Propose(command j) (index Index, term Term, isLeader bool) {
+	peers := c.peerIds()
+	c.Mutex.Lock()
+	defer c.Mutex.Unlock()
+	return c.propose(peers, LogEntry[j]{Command: command})
+}
+
+// propose appends entry to the log in the current term for Propose,
+// ProposeOnce, ProposeWait and Barrier. Like changeConfiguration it refuses
+// anyone but the leader, so a follower's log only ever changes through
+// AppendEntry and InstallSnapshot. It expects c.Mutex to be held.
+func (c *ConsensusModule[j, x, k]) propose(peers []uint, entry LogEntry[j]) (index Index, term Term, isLeader bool) {
+	if c.State != Leader || c.transferring {
+		return 0, c.CurrentTerm, false
+	}
+	entry.Term = c.CurrentTerm
+	c.Log = append(c.Log, entry)
+	if c.persistLog() != nil {
+		c.Log = c.Log[:len(c.Log)-1]
+		return 0, c.CurrentTerm, false
+	}
+	if len(peers) == 0 {
+		c.advanceCommitIndex(peers)
+	}
+	c.notifyReplicate()
+	lastIndex, _ := c.lastLog()
+	return lastIndex, c.CurrentTerm, true
+}
+
+// GetState returns a consistent snapshot of the node's term and role.
+func (c *ConsensusModule[j, x, k]) GetState() (term Term, isLeader bool, state ConsensusModuleState) {
+	c.Mutex.Lock()
+	defer c.Mutex.Unlock()
+	return c.CurrentTerm, c.State == Leader, c.State
+}
+
+// LastLogIndex returns the index of the last entry in the log, committed or
+// not, which is the snapshot's last index when the log is empty.
+func (c *ConsensusModule[j, x, k]) LastLogIndex() Index {
+	c.Mutex.Lock()
+	defer c.Mutex.Unlock()
+	lastIndex, _ := c.lastLog()
+	return lastIndex
+}
+
+// LastLogTerm returns the term of the entry at LastLogIndex.
+func (c *ConsensusModule[j, x, k]) LastLogTerm() Term {
+	c.Mutex.Lock()
+	defer c.Mutex.Unlock()
+	_, lastTerm := c.lastLog()
+	return lastTerm
+}
+
+// GetCommitIndex returns CommitIndex under the mutex, for callers that cannot
+// read the field while the module is running.
+func (c *ConsensusModule[j, x, k]) GetCommitIndex() Index {
+	c.Mutex.Lock()
+	defer c.Mutex.Unlock()
+	return c.CommitIndex
+}
+
 func (c *ConsensusModule[j, x, k]) ResetTicker() {
+	c.Mutex.Lock()
+	defer c.Mutex.Unlock()
+	c.resetTicker()
+}
+
+// resetTicker restarts the ticker with TickerDuration, unless it has been
+// stopped. It expects c.Mutex to be held.
+func (c *ConsensusModule[j, x, k]) resetTicker() {
 	if c.Ticker == nil {
-		c.Ticker = time.NewTicker(c.TickerDuration)
-	} else {
+		c.Ticker = c.Config.Clock.NewTicker(c.TickerDuration)
+	} else if !c.tickerStopped {
 		c.Ticker.Reset(c.TickerDuration)
 	}
 }
+
+// stopTicker stops the ticker once the run loop is gone, so that an RPC
+// handled afterwards cannot start it again. It expects c.Mutex to be held.
+func (c *ConsensusModule[j, x, k]) stopTicker() {
+	c.tickerStopped = true
+	c.Ticker.Stop()
+}
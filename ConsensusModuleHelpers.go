@@ -1,88 +1,301 @@
 package raft
 
 import (
+	"context"
+	"fmt"
 	"math/rand"
 	"sync"
 	"time"
 )
 
-func (c *ConsensusModule[j, x, k]) NewHeartbeat() AppendEntries[j] {
+// NewHeartbeat builds an empty AppendEntries for peer whose previous entry is
+// the one just before the peer's NextIndex. It expects c.Mutex to be held.
+func (c *ConsensusModule[j, x, k]) NewHeartbeat(peer uint) AppendEntries[j] {
+	lastIndex, _ := c.lastLog()
+	prevLogIndex := lastIndex
+	if next, ok := c.NextIndex[peer]; ok && next <= lastIndex {
+		prevLogIndex = max(next, 1) - 1
+	}
 	return AppendEntries[j]{
 		Term:         c.CurrentTerm,
 		LeaderId:     c.Id,
-		PrevLogIndex: -1,
-		PrevLogTerm:  *new(j),
+		PrevLogIndex: prevLogIndex,
+		PrevLogTerm:  c.termAt(prevLogIndex),
 		Entries:      []LogEntry[j]{},
-		LeaderCommit: uint(len(c.Log)),
+		LeaderCommit: c.CommitIndex,
 	}
 }
 
-func (c *ConsensusModule[j, x, k]) NewRequestVote(newCM bool) RequestVote[j] {
-	var serverRequestVote RequestVote[j]
-	if newCM {
-		serverRequestVote = RequestVote[j]{
-			Term:         c.CurrentTerm,
-			CandidateId:  c.Id,
-			LastLogIndex: 1,
-			LastLogTerm:  *new(j),
-		}
-	} else {
-		serverRequestVote = RequestVote[j]{
-			Term:         c.CurrentTerm,
-			CandidateId:  c.Id,
-			LastLogIndex: len(c.Log) + 1,
-			LastLogTerm:  c.Log[len(c.Log)-1].Command,
-		}
+// NewRequestVote asks for a vote in the current term on the strength of our
+// last entry, which is the snapshot's last entry, or index 0 and term 0, when
+// the log is empty. It expects c.Mutex to be held.
+func (c *ConsensusModule[j, x, k]) NewRequestVote() RequestVote[j] {
+	lastIndex, lastTerm := c.lastLog()
+	return RequestVote[j]{
+		Term:         c.CurrentTerm,
+		CandidateId:  c.Id,
+		LastLogIndex: lastIndex,
+		LastLogTerm:  lastTerm,
 	}
-
-	return serverRequestVote
 }
 
-func NewConsensusModule[j, x comparable, k any](contact Contact[j, x, k]) *ConsensusModule[j, x, k] {
+// NewConsensusModule builds a follower with the given id whose term, vote and
+// log are restored from storage. Unless storage holds a configuration, the
+// peers reported by contact must not include id; duplicates among them are
+// ignored, and an empty set makes a single-node cluster. Storage and contact
+// are handed the module's Codec if they are CodecUsers. It fails if the
+// persisted state cannot be read, since starting from scratch would break the
+// votes and entries already promised.
+func NewConsensusModule[j any, x comparable, k any](id uint, contact Contact[j, x, k], storage Storage[j], options ...Option) (*ConsensusModule[j, x, k], error) {
+	config := defaultConfig()
+	for _, option := range options {
+		option(&config)
+	}
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+	var codec Codec[j] = JSONCodec[j]{}
+	if config.Codec != nil {
+		given, ok := config.Codec.(Codec[j])
+		if !ok {
+			return nil, fmt.Errorf("%w: %T", ErrCodecType, config.Codec)
+		}
+		codec = given
+	}
+	var fsm FSM[j]
+	if config.FSM != nil {
+		given, ok := config.FSM.(FSM[j])
+		if !ok {
+			return nil, fmt.Errorf("%w: %T", ErrFSMType, config.FSM)
+		}
+		fsm = given
+	}
+	if user, ok := storage.(CodecUser[j]); ok {
+		user.UseCodec(codec)
+	}
+	if user, ok := contact.(CodecUser[j]); ok {
+		user.UseCodec(codec)
+	}
+	seed := config.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	mutex := new(sync.Mutex)
 	cm := &ConsensusModule[j, x, k]{
-		Mutex: new(sync.Mutex),
-		Id:    uint(rand.Uint64()),
-		State: Follower,
+		Mutex:  mutex,
+		Id:     id,
+		State:  Follower,
+		Config: config,
+		random: rand.New(rand.NewSource(seed ^ int64(id))),
 
-		ReceiveChan: new(chan k),
+		CommitIndex: 1,
+		LastApplied: 1,
+
+		ReceiveChan: make(chan ApplyMsg[j], config.BufferSize),
 		Contact:     contact,
+		Storage:     storage,
+		Codec:       codec,
+		fsm:         fsm,
+		results:     make(map[Index]*applyResult),
+		applyNotify: make(chan struct{}, 1),
+		applied:     sync.NewCond(mutex),
+		replicate:   make(chan struct{}, 1),
+		timeoutNow:  make(chan struct{}, 1),
+		campaign:    make(chan struct{}, 1),
+
+		ApplyBatchChan: make(chan []ApplyMsg[j], config.BufferSize),
+
+		metricsNotify: make(chan struct{}, 1),
+
+		leaderChanges:    make(chan bool),
+		leadershipNotify: make(chan struct{}, 1),
 
 		CurrentTerm: 0,
 		VotedFor:    -1,
-		Log: []LogEntry[j]{
-			{
-				Command: contact.DefaultLogEntryCommand(),
-				Term:    0,
-			},
+	}
+	err := cm.restore([]LogEntry[j]{
+		{
+			Command: contact.DefaultLogEntryCommand(),
+			Term:    0,
 		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("raft: restoring persisted state: %w", err)
+	}
+	cm.restoreConfiguration()
+	cm.skipApplied(config.AppliedIndex)
+	if cm.configuration == nil {
+		if err := validatePeers(id, contact.GetPeerIds()); err != nil {
+			return nil, err
+		}
 	}
 	cm.SetTicker()
-	cm.ResetTicker()
-	return cm
+	return cm, nil
+}
+
+// rpcContext bounds a round of RPCs by timeout, so that a stalled peer counts
+// as not answering instead of holding up the round.
+func (c *ConsensusModule[j, x, k]) rpcContext(timeout time.Duration) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), timeout)
+}
+
+// RandomId returns a random node id for callers that have no stable one.
+func RandomId() uint {
+	return uint(rand.Uint64())
 }
 
 func (c *ConsensusModule[j, x, k]) SetTicker() {
-	if c.State != Leader {
-		ri := rand.Intn(450)
-		for ri < 250 {
-			ri = rand.Intn(450)
-		}
-		c.TickerDuration = time.Duration(ri) * time.Millisecond
-	} else {
-		ri := rand.Intn(200)
-		for ri < 50 {
-			ri = rand.Intn(200)
-		}
-		c.TickerDuration = time.Duration(ri) * time.Millisecond
+	c.Mutex.Lock()
+	defer c.Mutex.Unlock()
+	c.setTicker()
+}
+
+// setTicker picks a new random tick for the current state: followers and
+// candidates wait an election timeout and leaders a heartbeat interval, both
+// drawn from the ranges in c.Config. It expects c.Mutex to be held.
+func (c *ConsensusModule[j, x, k]) setTicker() {
+	switch c.State {
+	case Follower, Candidate:
+		c.TickerDuration = randomDuration(c.random, c.Config.ElectionTimeoutMin, c.Config.ElectionTimeoutMax)
+	case Leader:
+		c.TickerDuration = randomDuration(c.random, c.Config.HeartbeatIntervalMin, c.Config.HeartbeatIntervalMax)
 	}
 
-	c.ResetTicker()
+	c.resetTicker()
+}
+
+// randomDuration returns a duration in [min, max) drawn from random, or min
+// when the range is empty.
+func randomDuration(random *rand.Rand, min, max time.Duration) time.Duration {
+	if max <= min {
+		return min
+	}
+	return min + time.Duration(random.Int63n(int64(max-min)))
 }
 
-func (c *ConsensusModule[j, x, k]) lastLog() (int, j) {
+func (c *ConsensusModule[j, x, k]) lastLog() (Index, Term) {
 	if len(c.Log) == 0 {
-		return 1, *new(j)
+		return c.LastIncludedIndex, c.LastIncludedTerm
 	} else {
-		return len(c.Log), c.Log[len(c.Log)-1].Command
+		return c.LastIncludedIndex + Index(len(c.Log)), c.Log[len(c.Log)-1].Term
+	}
+}
+
+// offset converts a log index into a position in c.Log. The position is only
+// valid to index with when ok is true; indices that have been compacted into
+// the snapshot or lie past the end of the log report false.
+func (c *ConsensusModule[j, x, k]) offset(index Index) (position int, ok bool) {
+	position = int(index) - int(c.LastIncludedIndex) - 1
+	return position, position >= 0 && position < len(c.Log)
+}
+
+// entryAt returns the entry at index if it is still held in c.Log.
+func (c *ConsensusModule[j, x, k]) entryAt(index Index) (LogEntry[j], bool) {
+	position, ok := c.offset(index)
+	if !ok {
+		return LogEntry[j]{}, false
+	}
+	return c.Log[position], true
+}
+
+// termAt returns the term of the entry at index, or 0 for the empty prefix,
+// compacted entries and indices past the end of the log.
+func (c *ConsensusModule[j, x, k]) termAt(index Index) Term {
+	if index == c.LastIncludedIndex {
+		return c.LastIncludedTerm
+	}
+	entry, _ := c.entryAt(index)
+	return entry.Term
+}
+
+// prevLogMatches reports whether our log holds an entry at prevLogIndex with
+// term prevLogTerm. Index 0 is the empty prefix and, like every index covered
+// by the snapshot, always matches since only committed entries are compacted.
+// An index past the end of our log never matches; conflict then points the
+// leader just past our last entry.
+func (c *ConsensusModule[j, x, k]) prevLogMatches(prevLogIndex Index, prevLogTerm Term) bool {
+	if prevLogIndex < 1 || prevLogIndex < c.LastIncludedIndex {
+		return true
+	}
+	if lastIndex, _ := c.lastLog(); prevLogIndex > lastIndex {
+		return false
+	}
+	return c.termAt(prevLogIndex) == prevLogTerm
+}
+
+// conflict locates where our log disagrees with a leader whose previous entry
+// at prevLogIndex did not match: one past our last entry when the log is too
+// short, otherwise the first index holding the term found at prevLogIndex.
+func (c *ConsensusModule[j, x, k]) conflict(prevLogIndex Index) (index Index, term Term) {
+	if lastIndex, _ := c.lastLog(); prevLogIndex > lastIndex {
+		return lastIndex + 1, 0
+	}
+	term = c.termAt(prevLogIndex)
+	first := prevLogIndex
+	for first > c.LastIncludedIndex+1 && c.termAt(first-1) == term {
+		first--
+	}
+	return first, term
+}
+
+// lastIndexOf returns the last index in our log holding term, or 0 if none
+// does.
+func (c *ConsensusModule[j, x, k]) lastIndexOf(term Term) Index {
+	lastIndex, _ := c.lastLog()
+	for index := lastIndex; index > c.LastIncludedIndex; index-- {
+		switch entryTerm := c.termAt(index); {
+		case entryTerm == term:
+			return index
+		case entryTerm < term:
+			return 0
+		}
+	}
+	return 0
+}
+
+// mergeEntries writes entries into the log directly after prevLogIndex. An
+// existing entry whose term conflicts is dropped along with everything after
+// it, while entries we already hold are left alone so retries are no-ops. It
+// reports whether the log changed.
+func (c *ConsensusModule[j, x, k]) mergeEntries(prevLogIndex Index, entries []LogEntry[j]) bool {
+	for i, entry := range entries {
+		index := prevLogIndex + Index(i) + 1
+		position, ok := c.offset(index)
+		if position < 0 {
+			continue
+		}
+		if ok {
+			if c.Log[position].Term == entry.Term {
+				continue
+			}
+			c.Log = c.Log[:position]
+		}
+		c.Log = append(c.Log, entries[i:]...)
+		return true
+	}
+	return false
+}
+
+// termsOrdered reports whether the terms of the entries never decrease,
+// starting from PrevLogTerm, and never exceed the term of the request, as is
+// always the case for a correct leader.
+func termsOrdered[j any](entries AppendEntries[j]) bool {
+	term := entries.PrevLogTerm
+	for _, entry := range entries.Entries {
+		if entry.Term < term || entry.Term > entries.Term {
+			return false
+		}
+		term = entry.Term
+	}
+	return true
+}
+
+// logUpToDate reports whether a candidate's last log entry is at least as
+// up-to-date as ours, comparing terms first and then indices.
+func (c *ConsensusModule[j, x, k]) logUpToDate(lastLogIndex Index, lastLogTerm Term) bool {
+	nodeLastLogLen, nodeLastLogTerm := c.lastLog()
+	if lastLogTerm != nodeLastLogTerm {
+		return lastLogTerm > nodeLastLogTerm
 	}
+	return lastLogIndex >= nodeLastLogLen
 }
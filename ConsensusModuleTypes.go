@@ -1,10 +1,52 @@
 package raft
 
 import (
+	"context"
+	"errors"
+	"math/rand"
 	"sync"
 	"time"
 )
 
+var (
+	ErrNotLeader   = errors.New("raft: not the leader")
+	ErrUnknownPeer = errors.New("raft: unknown peer")
+	ErrNotApplied  = errors.New("raft: index has not been applied")
+	ErrOverwritten = errors.New("raft: entry was overwritten by a later leader")
+	ErrClosed      = errors.New("raft: module is closed")
+
+	ErrNotReady              = errors.New("raft: leader has not committed an entry in its term")
+	ErrLeadershipUnconfirmed = errors.New("raft: leadership could not be confirmed by a majority")
+	ErrLeaseExpired          = errors.New("raft: leader lease has expired")
+
+	ErrAlreadyMember       = errors.New("raft: already a member")
+	ErrConfigurationChange = errors.New("raft: a configuration change is already in progress")
+	ErrNotMember           = errors.New("raft: not a member of the configuration")
+	ErrNotFresh            = errors.New("raft: node already has persisted state")
+	ErrConfChangeType      = errors.New("raft: unknown configuration change")
+
+	ErrSelfPeer      = errors.New("raft: peers include our own id")
+	ErrInvalidConfig = errors.New("raft: invalid configuration")
+
+	ErrLearnerBehind = errors.New("raft: learner has not caught up")
+
+	ErrWALCorrupt = errors.New("raft: write-ahead log is corrupt")
+
+	ErrCodecType = errors.New("raft: codec does not match the command type")
+	ErrFSMType   = errors.New("raft: state machine does not match the command type")
+
+	ErrCompacted       = errors.New("raft: entries have been compacted into a snapshot")
+	ErrIndexOutOfRange = errors.New("raft: index is out of range")
+)
+
+// Term is an election term. Terms only ever increase, and every log entry
+// records the term of the leader that created it.
+type Term uint
+
+// Index is the position of an entry in the log. Indices are 1-based, with 0
+// standing for the empty log before the first entry.
+type Index uint
+
 type ConsensusModuleState int
 
 const (
@@ -13,12 +55,26 @@ const (
 	Leader
 )
 
-type Contact[j, x comparable, k any] interface {
+// Contact is everything a module needs from the world around it: a Transport
+// to reach its peers and the Application whose commands it replicates.
+type Contact[j any, x comparable, k any] interface {
+	Transport[j]
+	Application[j, x]
+}
+
+// Transport carries RPCs to the other members of the cluster. The RPC methods
+// must return once ctx is done, leaving out the peers that have not answered.
+type Transport[j any] interface {
 	GetPeerIds() []uint
+	RequestVotes(ctx context.Context, vote RequestVote[j]) map[uint]Reply
+	AppendEntries(ctx context.Context, entries map[uint]AppendEntries[j]) map[uint]Reply
+	InstallSnapshot(ctx context.Context, peer uint, snapshot InstallSnapshot) Reply
+}
+
+// Application is the state machine side of a Contact.
+type Application[j any, x comparable] interface {
 	GetLeader() uint
 	GetLeaderLog() []LogEntry[j]
-	RequestVotes(vote RequestVote[j]) []Reply
-	AppendEntries(entries AppendEntries[j]) []Reply
 	ValidLogEntryCommand(j) bool
 	ValidLog([]LogEntry[j]) bool
 	ExecuteLog(uint, []j) error
@@ -26,54 +82,191 @@ type Contact[j, x comparable, k any] interface {
 	LogValue([]LogEntry[j]) x
 }
 
-type LogEntry[j comparable] struct {
-	Command j
-	Term    uint
+type LogEntryType int
+
+const (
+	CommandEntry LogEntryType = iota
+	ConfigurationEntry
+	NoOpEntry
+)
+
+// LogEntry is a single slot in the log. Command entries carry an application
+// command, along with the ClientId and Seq it was proposed under by
+// ProposeOnce; configuration entries carry the full voter set in
+// Configuration and the non-voting learners in Learners. No-op entries
+// carry nothing and are never delivered on ReceiveChan.
+//
+// Commands may be of any type, since entries are only ever compared by Term.
+// FileStorage, WALStorage and the transports encode them with the module's
+// Codec, JSONCodec unless WithCodec gives another, so a command type has to
+// survive a round trip through it.
+type LogEntry[j any] struct {
+	Command       j
+	Term          Term
+	Type          LogEntryType
+	Configuration []uint
+	Learners      []uint
+	ClientId      uint
+	Seq           uint
 }
 
-type RequestVote[j comparable] struct {
-	Term         uint
-	CandidateId  uint
-	LastLogIndex int
-	LastLogTerm  j
+// ApplyMsg is delivered on ReceiveChan, or in batches on ApplyBatchChan, for
+// every committed command, in log order, leaving out retries of a client
+// request that was already applied. ClientId and Seq name the request a
+// ProposeOnce command came from, so the application can keep its result for
+// a retry to collect. When SnapshotValid is set it instead carries a snapshot
+// the state machine must restore, with Index and Term naming the last entry
+// it covers.
+type ApplyMsg[j any] struct {
+	Command  j
+	Index    Index
+	Term     Term
+	ClientId uint
+	Seq      uint
+
+	SnapshotValid bool
+	Snapshot      []byte
+}
+
+// RequestVote asks for a vote in Term. With PreVote set it only asks whether
+// the vote would be granted, leaving the receiver's term and vote untouched.
+// LeadershipTransfer marks the election of a transfer target told to start
+// one by TimeoutNow, which Config.LeaderStickiness lets through.
+type RequestVote[j any] struct {
+	Term               Term
+	CandidateId        uint
+	LastLogIndex       Index
+	LastLogTerm        Term
+	PreVote            bool
+	LeadershipTransfer bool
 }
 
+// Reply answers any of the RPCs. An AppendEntries rejected because the
+// previous entry did not match carries ConflictIndex, the first index of
+// ConflictTerm in the follower's log, or one past its last entry with a zero
+// ConflictTerm when the log is too short.
 type Reply struct {
-	Term        uint
-	VoteGranted bool
+	Term          Term
+	VoteGranted   bool
+	Success       bool
+	ConflictIndex Index
+	ConflictTerm  Term
 }
 
-type AppendEntries[j comparable] struct {
-	Term         uint
+// AppendEntries replicates Entries after PrevLogIndex. TimeoutNow asks an
+// up to date receiver to start an election straight away.
+type AppendEntries[j any] struct {
+	Term         Term
 	LeaderId     uint
-	PrevLogIndex int
-	PrevLogTerm  j
+	PrevLogIndex Index
+	PrevLogTerm  Term
 	Entries      []LogEntry[j]
-	LeaderCommit uint
+	LeaderCommit Index
+	TimeoutNow   bool
 }
 
-type ConsensusModule[j, x comparable, k any] struct {
+// InstallSnapshot ships the leader's snapshot to a follower whose NextIndex
+// falls inside the compacted part of the log.
+type InstallSnapshot struct {
+	Term              Term
+	LeaderId          uint
+	LastIncludedIndex Index
+	LastIncludedTerm  Term
+	Configuration     []uint
+	Learners          []uint
+	Sessions          map[uint]ClientSession
+	Data              []byte
+}
+
+type ConsensusModule[j any, x comparable, k any] struct {
 	Mutex          *sync.Mutex
 	Id             uint
 	State          ConsensusModuleState
-	Ticker         *time.Ticker
+	Ticker         Ticker
 	TickerDuration time.Duration
+	tickerStopped  bool
+	Config         Config
+	random         *rand.Rand
 
 	// Volatile state in memory
-	LeaderId    uint
-	CommitIndex uint
-	LastApplied uint
+	LeaderId      uint
+	CommitIndex   Index
+	LastApplied   Index
+	leaderContact time.Time
 
 	// Volatile state for leaders
-	NextIndex  []uint
-	MatchIndex []uint
+	NextIndex        map[uint]Index
+	MatchIndex       map[uint]Index
+	inflight         map[uint]int
+	peerContact      map[uint]time.Time
+	backoff          map[uint]peerBackoff
+	quorumChecked    time.Time
+	transferring     bool
+	transferTarget   uint
+	transferDeadline time.Time
+	leaseStart       time.Time
 
-	// Concurrent API communication
-	ReceiveChan *chan k
+	// Concurrent API communication. ReceiveChan delivers committed entries
+	// to the application and is only ever sent on by the module; it took
+	// over from ApplyChan, and a send on it no longer resets the ticker.
+	ReceiveChan chan ApplyMsg[j]
 	Contact     Contact[j, x, k]
+	Storage     Storage[j]
+	Codec       Codec[j]
+	fsm         FSM[j]
+	results     map[Index]*applyResult
+	applyNotify chan struct{}
+	applied     *sync.Cond
+	replicate   chan struct{}
+	timeoutNow  chan struct{}
+	campaign    chan struct{}
+
+	// ApplyBatchChan takes the place of ReceiveChan with
+	// Config.ApplyBatchSize above one.
+	ApplyBatchChan chan []ApplyMsg[j]
+
+	// Lifecycle of the goroutines started by Start or RunServer
+	cancel    context.CancelFunc
+	workers   sync.WaitGroup
+	closeOnce sync.Once
+	closed    bool
+
+	// Metrics events waiting for the metrics loop, only collected while one
+	// runs
+	events        []func(Metrics)
+	metricsNotify chan struct{}
+	metricsLoops  int
+
+	// Leadership transitions waiting for the leadership loop
+	leaderChanges      chan bool
+	leadershipEvents   []bool
+	leadershipNotify   chan struct{}
+	watchingLeadership bool
+
+	// Persistent state, saved through Storage. Log indices are 1-based and
+	// the entries up to LastIncludedIndex live only in the snapshot, so the
+	// entry at index i is Log[i-LastIncludedIndex-1]. Index 0 is the empty
+	// log before the first entry.
+	CurrentTerm       Term
+	VotedFor          int
+	Log               []LogEntry[j]
+	LastIncludedIndex Index
+	LastIncludedTerm  Term
+	snapshot          []byte
+	logUnsaved        bool
+
+	// Last request applied for each client, as of LastApplied and as of the
+	// snapshot
+	sessions         map[uint]ClientSession
+	snapshotSessions map[uint]ClientSession
 
-	// Persistent state in memory
-	CurrentTerm uint
-	VotedFor    int
-	Log         []LogEntry[j]
+	// Committed voter set, including ourselves, or nil until the first
+	// configuration entry commits
+	configuration []uint
+	// Committed learners, which are replicated to but never vote
+	learners []uint
+	// Voters and learners as of the snapshot, nil when it predates the first
+	// configuration entry
+	snapshotConfiguration []uint
+	snapshotLearners      []uint
 }
@@ -0,0 +1,61 @@
+package raft
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestTermsAndIndicesRoundTrip(t *testing.T) {
+	// Every term differs from every index, so a swap anywhere shows.
+	messages := []any{
+		&RequestVote[string]{Term: 7, CandidateId: 2, LastLogIndex: 4, LastLogTerm: 6},
+		&AppendEntries[string]{
+			Term:         7,
+			LeaderId:     2,
+			PrevLogIndex: 4,
+			PrevLogTerm:  6,
+			Entries:      []LogEntry[string]{{Term: 7, Command: "SET a 1"}},
+			LeaderCommit: 3,
+		},
+		&Reply{Term: 7, ConflictIndex: 4, ConflictTerm: 6},
+	}
+	for _, message := range messages {
+		data, err := json.Marshal(message)
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoded := reflect.New(reflect.TypeOf(message).Elem()).Interface()
+		if err := json.Unmarshal(data, decoded); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(decoded, message) {
+			t.Errorf("round trip of %T gave %+v, want %+v", message, decoded, message)
+		}
+	}
+
+	modules, _ := newCluster(t, 3)
+	follower := modules[1]
+	reply := follower.AppendEntry(AppendEntries[string]{
+		Term:         7,
+		LeaderId:     1,
+		PrevLogIndex: 1,
+		Entries:      []LogEntry[string]{{Term: 6, Command: "SET a 1"}, {Term: 7, Command: "SET b 2"}},
+		LeaderCommit: 2,
+	})
+	if !reply.Success || reply.Term != 7 {
+		t.Fatalf("AppendEntry = %+v, want success in term 7", reply)
+	}
+	if term, _, _ := follower.GetState(); term != 7 {
+		t.Errorf("term %d, want 7", term)
+	}
+	if index, term := follower.LastLogIndex(), follower.LastLogTerm(); index != 3 || term != 7 {
+		t.Errorf("last entry %d in term %d, want 3 in term 7", index, term)
+	}
+	if entry, err := follower.Get(2); err != nil || entry.Term != 6 {
+		t.Errorf("Get(2) = %v, %v; want the entry in term 6", entry, err)
+	}
+	if commit := follower.GetCommitIndex(); commit != 2 {
+		t.Errorf("commit index %d, want 2", commit)
+	}
+}
@@ -0,0 +1,618 @@
+package raft
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// setTerm puts module in term, having voted for votedFor, as if it had been
+// running for a while.
+func setTerm(module *testModule, term Term, votedFor int) {
+	module.Mutex.Lock()
+	defer module.Mutex.Unlock()
+	module.CurrentTerm = term
+	module.VotedFor = votedFor
+}
+
+func TestVoteTerm(t *testing.T) {
+	tests := []struct {
+		name     string
+		term     Term
+		votedFor int
+		granted  bool
+		replyAt  Term
+	}{
+		{name: "lower term", term: 1, votedFor: -1, granted: false, replyAt: 2},
+		{name: "equal term", term: 2, votedFor: -1, granted: true, replyAt: 2},
+		{name: "equal term after voting", term: 2, votedFor: 3, granted: false, replyAt: 2},
+		{name: "higher term", term: 3, votedFor: 3, granted: true, replyAt: 3},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			modules, _ := newCluster(t, 3)
+			voter := modules[0]
+			setTerm(voter, 2, test.votedFor)
+			reply := voter.Vote(RequestVote[string]{
+				Term:         test.term,
+				CandidateId:  2,
+				LastLogIndex: 1,
+			})
+			if reply.VoteGranted != test.granted || reply.Term != test.replyAt {
+				t.Errorf("Vote = granted %v in term %d, want %v in term %d", reply.VoteGranted, reply.Term, test.granted, test.replyAt)
+			}
+			if term, _, _ := voter.GetState(); term != test.replyAt {
+				t.Errorf("voter is in term %d, want %d", term, test.replyAt)
+			}
+		})
+	}
+}
+
+// appendTerms appends entries in the given terms to the log of module.
+func appendTerms(module *testModule, terms ...Term) {
+	module.Mutex.Lock()
+	defer module.Mutex.Unlock()
+	for _, term := range terms {
+		module.Log = append(module.Log, LogEntry[string]{Term: term, Command: "SET"})
+	}
+}
+
+func TestVoteLogUpToDate(t *testing.T) {
+	tests := []struct {
+		name      string
+		lastIndex Index
+		lastTerm  Term
+		granted   bool
+	}{
+		{name: "shorter log", lastIndex: 2, lastTerm: 1, granted: false},
+		{name: "equal log", lastIndex: 3, lastTerm: 1, granted: true},
+		{name: "longer log", lastIndex: 4, lastTerm: 1, granted: true},
+		{name: "longer log in an older term", lastIndex: 9, lastTerm: 0, granted: false},
+		{name: "shorter log in a newer term", lastIndex: 2, lastTerm: 2, granted: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			modules, _ := newCluster(t, 3)
+			voter := modules[0]
+			appendTerms(voter, 1, 1)
+			setTerm(voter, 2, -1)
+			reply := voter.Vote(RequestVote[string]{
+				Term:         2,
+				CandidateId:  2,
+				LastLogIndex: test.lastIndex,
+				LastLogTerm:  test.lastTerm,
+			})
+			if reply.VoteGranted != test.granted {
+				t.Errorf("Vote granted %v, want %v", reply.VoteGranted, test.granted)
+			}
+		})
+	}
+}
+
+func TestConcurrentVotesAndAppends(t *testing.T) {
+	modules, _ := startCluster(t, 3)
+	target := modules[0]
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for term := Term(1); term <= 50; term++ {
+				if i%2 == 0 {
+					target.Vote(RequestVote[string]{Term: term, CandidateId: 2, LastLogIndex: 1})
+				} else {
+					target.AppendEntry(AppendEntries[string]{Term: term, LeaderId: 3, PrevLogIndex: 1})
+				}
+				target.GetState()
+			}
+		}(i)
+	}
+	wg.Wait()
+	if term, _, _ := target.GetState(); term < 50 {
+		t.Errorf("term %d after requests up to term 50", term)
+	}
+}
+
+func TestVoteAgainInHigherTerm(t *testing.T) {
+	modules, _ := newCluster(t, 3)
+	voter := modules[0]
+	setTerm(voter, 2, -1)
+	if reply := voter.Vote(RequestVote[string]{Term: 2, CandidateId: 2, LastLogIndex: 1}); !reply.VoteGranted {
+		t.Fatal("first vote in term 2 refused")
+	}
+	if reply := voter.Vote(RequestVote[string]{Term: 2, CandidateId: 3, LastLogIndex: 1}); reply.VoteGranted {
+		t.Fatal("second vote in term 2 granted")
+	}
+
+	// A heartbeat from a newer leader moves the voter into term 3 without
+	// casting a vote there, so it has one to give.
+	voter.AppendEntry(AppendEntries[string]{Term: 3, LeaderId: 2, PrevLogIndex: 1})
+	if reply := voter.Vote(RequestVote[string]{Term: 3, CandidateId: 3, LastLogIndex: 1}); !reply.VoteGranted || reply.Term != 3 {
+		t.Errorf("Vote in term 3 = granted %v in term %d, want granted in term 3", reply.VoteGranted, reply.Term)
+	}
+}
+
+func TestAppendEntryPrevLogCheck(t *testing.T) {
+	tests := []struct {
+		name      string
+		prevIndex Index
+		prevTerm  Term
+		success   bool
+		lastIndex Index
+	}{
+		{name: "matching prev entry", prevIndex: 3, prevTerm: 1, success: true, lastIndex: 4},
+		{name: "missing prev entry", prevIndex: 5, prevTerm: 1, success: false, lastIndex: 3},
+		{name: "term conflict at prev entry", prevIndex: 3, prevTerm: 2, success: false, lastIndex: 3},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			modules, _ := newCluster(t, 3)
+			follower := modules[0]
+			appendTerms(follower, 1, 1)
+			setTerm(follower, 2, -1)
+			reply := follower.AppendEntry(AppendEntries[string]{
+				Term:         2,
+				LeaderId:     2,
+				PrevLogIndex: test.prevIndex,
+				PrevLogTerm:  test.prevTerm,
+				Entries:      []LogEntry[string]{{Term: 2, Command: "SET"}},
+			})
+			if reply.Success != test.success {
+				t.Errorf("AppendEntry succeeded: %v, want %v", reply.Success, test.success)
+			}
+			if last := follower.LastLogIndex(); last != test.lastIndex {
+				t.Errorf("last log index %d, want %d", last, test.lastIndex)
+			}
+		})
+	}
+}
+
+// logTerms returns the terms of the entries in the log of module.
+func logTerms(module *testModule) []Term {
+	module.Mutex.Lock()
+	defer module.Mutex.Unlock()
+	terms := make([]Term, len(module.Log))
+	for i, entry := range module.Log {
+		terms[i] = entry.Term
+	}
+	return terms
+}
+
+func TestAppendEntryMergesEntries(t *testing.T) {
+	tests := []struct {
+		name      string
+		prevIndex Index
+		entries   []Term
+		want      []Term
+	}{
+		{name: "clean append", prevIndex: 4, entries: []Term{2, 2}, want: []Term{0, 1, 1, 1, 2, 2}},
+		{name: "overlapping append", prevIndex: 2, entries: []Term{1, 1}, want: []Term{0, 1, 1, 1}},
+		{name: "overlapping append with new entries", prevIndex: 3, entries: []Term{1, 2}, want: []Term{0, 1, 1, 1, 2}},
+		{name: "conflicting append", prevIndex: 2, entries: []Term{2}, want: []Term{0, 1, 2}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			modules, _ := newCluster(t, 3)
+			follower := modules[0]
+			appendTerms(follower, 1, 1, 1)
+			setTerm(follower, 2, -1)
+			request := AppendEntries[string]{
+				Term:         2,
+				LeaderId:     2,
+				PrevLogIndex: test.prevIndex,
+				PrevLogTerm:  1,
+			}
+			for _, term := range test.entries {
+				request.Entries = append(request.Entries, LogEntry[string]{Term: term, Command: "SET"})
+			}
+			// The second delivery is a retry and must change nothing.
+			for attempt := 1; attempt <= 2; attempt++ {
+				if reply := follower.AppendEntry(request); !reply.Success {
+					t.Fatalf("attempt %d refused", attempt)
+				}
+				if terms := logTerms(follower); !slices.Equal(terms, test.want) {
+					t.Errorf("attempt %d: log terms %v, want %v", attempt, terms, test.want)
+				}
+			}
+		})
+	}
+}
+
+func TestFollowerCommitFollowsLeader(t *testing.T) {
+	modules, _ := newCluster(t, 3)
+	follower := modules[0]
+	setTerm(follower, 1, -1)
+	commands := []LogEntry[string]{{Term: 1, Command: "SET a"}, {Term: 1, Command: "SET b"}}
+	follower.AppendEntry(AppendEntries[string]{Term: 1, LeaderId: 2, PrevLogIndex: 1, Entries: commands, LeaderCommit: 1})
+	if commit := follower.GetCommitIndex(); commit != 1 {
+		t.Fatalf("commit index %d before the leader committed anything, want 1", commit)
+	}
+
+	follower.AppendEntry(AppendEntries[string]{Term: 1, LeaderId: 2, PrevLogIndex: 3, PrevLogTerm: 1, LeaderCommit: 2})
+	if commit := follower.GetCommitIndex(); commit != 2 {
+		t.Errorf("commit index %d after the leader committed 2, want 2", commit)
+	}
+	// The leader may have committed entries this follower has not been sent;
+	// it commits no further than what the request brought it to.
+	follower.AppendEntry(AppendEntries[string]{Term: 1, LeaderId: 2, PrevLogIndex: 2, PrevLogTerm: 1, LeaderCommit: 9})
+	if commit := follower.GetCommitIndex(); commit != 2 {
+		t.Errorf("commit index %d after a request ending at 2, want 2", commit)
+	}
+	follower.AppendEntry(AppendEntries[string]{Term: 1, LeaderId: 2, PrevLogIndex: 3, PrevLogTerm: 1, LeaderCommit: 9})
+	if commit := follower.GetCommitIndex(); commit != 3 {
+		t.Errorf("commit index %d after a request ending at 3, want 3", commit)
+	}
+}
+
+func TestProposeOnlyOnLeader(t *testing.T) {
+	modules, _ := startCluster(t, 3)
+	leader := waitLeader(t, modules)
+	for _, module := range modules {
+		if module == leader {
+			continue
+		}
+		last := module.LastLogIndex()
+		if _, _, isLeader := module.Propose("SET follower 1"); isLeader {
+			t.Errorf("node %d accepted a proposal as a follower", module.Id)
+		}
+		if module.LastLogIndex() != last {
+			t.Errorf("node %d appended a proposal as a follower", module.Id)
+		}
+	}
+
+	index, term, isLeader := leader.Propose("SET leader 1")
+	if !isLeader {
+		t.Fatal("the leader refused a proposal")
+	}
+	waitCommitted(t, modules, index)
+	for _, module := range modules {
+		entry, err := module.Get(index)
+		if err != nil || entry.Command != "SET leader 1" || entry.Term != term {
+			t.Errorf("node %d: Get(%d) = %v, %v, want the proposal in term %d", module.Id, index, entry, err, term)
+		}
+	}
+}
+
+func TestTickerDurationBounds(t *testing.T) {
+	modules, _ := newCluster(t, 1, WithElectionTimeout(300*time.Millisecond, 500*time.Millisecond), WithHeartbeatInterval(20*time.Millisecond, 100*time.Millisecond))
+	module := modules[0]
+	bounds := map[ConsensusModuleState][2]time.Duration{
+		Follower:  {300 * time.Millisecond, 500 * time.Millisecond},
+		Candidate: {300 * time.Millisecond, 500 * time.Millisecond},
+		Leader:    {20 * time.Millisecond, 100 * time.Millisecond},
+	}
+	module.Mutex.Lock()
+	defer module.Mutex.Unlock()
+	for state, bound := range bounds {
+		module.State = state
+		for i := 0; i < 1000; i++ {
+			module.setTicker()
+			if tick := module.TickerDuration; tick < bound[0] || tick >= bound[1] {
+				t.Fatalf("%v ticks every %v, want between %v and %v", state, tick, bound[0], bound[1])
+			}
+		}
+	}
+}
+
+func TestIdInRequests(t *testing.T) {
+	network := NewInMemoryNetwork[string, int, bool]()
+	module, err := network.Add(7, NewMemoryStorage[string]())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(module.Close)
+	if module.Id != 7 {
+		t.Fatalf("Id = %d, want 7", module.Id)
+	}
+	module.Mutex.Lock()
+	defer module.Mutex.Unlock()
+	if vote := module.NewRequestVote(); vote.CandidateId != 7 {
+		t.Errorf("RequestVote from node %d, want 7", vote.CandidateId)
+	}
+	if heartbeat := module.NewHeartbeat(9); heartbeat.LeaderId != 7 {
+		t.Errorf("AppendEntries from node %d, want 7", heartbeat.LeaderId)
+	}
+}
+
+func TestGetStateAfterTransition(t *testing.T) {
+	modules, _ := startCluster(t, 3, quiet)
+	node := modules[0]
+	node.ForceElection()
+	if term, isLeader, state := node.GetState(); term != 1 || !isLeader || state != Leader {
+		t.Errorf("after winning: GetState = %d, %v, %v; want 1, true, Leader", term, isLeader, state)
+	}
+	node.AppendEntry(AppendEntries[string]{Term: 3, LeaderId: 2, PrevLogIndex: 1})
+	if term, isLeader, state := node.GetState(); term != 3 || isLeader || state != Follower {
+		t.Errorf("after a newer leader: GetState = %d, %v, %v; want 3, false, Follower", term, isLeader, state)
+	}
+}
+
+func TestStaleHeartbeatRejected(t *testing.T) {
+	modules, _ := newCluster(t, 3)
+	follower := modules[2]
+	follower.AppendEntry(AppendEntries[string]{Term: 4, LeaderId: 1, PrevLogIndex: 1})
+	reply := follower.AppendEntry(AppendEntries[string]{Term: 2, LeaderId: 2, PrevLogIndex: 1})
+	if reply.Success || reply.Term != 4 {
+		t.Errorf("stale heartbeat reply = %+v, want a refusal in term 4", reply)
+	}
+	if term, _, _ := follower.GetState(); term != 4 {
+		t.Errorf("term after a stale heartbeat = %d, want 4", term)
+	}
+	if hint, _ := follower.LeaderHint(); hint != 1 {
+		t.Errorf("stale heartbeat moved the leader hint to node %d", hint)
+	}
+}
+
+func TestNewRequestVoteLastEntry(t *testing.T) {
+	modules, _ := newCluster(t, 2)
+	empty, populated := modules[0], modules[1]
+	emptyLog(empty)
+	setTerm(empty, 1, -1)
+	appendTerms(populated, 1, 3)
+	setTerm(populated, 4, -1)
+	tests := []struct {
+		module    *testModule
+		lastIndex Index
+		lastTerm  Term
+	}{
+		{empty, 0, 0},
+		{populated, 3, 3},
+	}
+	for _, test := range tests {
+		test.module.Mutex.Lock()
+		vote := test.module.NewRequestVote()
+		test.module.Mutex.Unlock()
+		if vote.LastLogIndex != test.lastIndex || vote.LastLogTerm != test.lastTerm {
+			t.Errorf("node %d: RequestVote follows %d in term %d, want %d in term %d",
+				test.module.Id, vote.LastLogIndex, vote.LastLogTerm, test.lastIndex, test.lastTerm)
+		}
+	}
+}
+
+func TestPrevLogIndexPastEnd(t *testing.T) {
+	modules, _ := newCluster(t, 3)
+	follower := modules[1]
+	appendTerms(follower, 1, 1)
+	reply := follower.AppendEntry(AppendEntries[string]{Term: 2, LeaderId: 1, PrevLogIndex: 500, PrevLogTerm: 2})
+	if reply.Success || reply.ConflictIndex != 4 || reply.ConflictTerm != 0 {
+		t.Errorf("reply = %+v, want a refusal pointing one past the end at 4", reply)
+	}
+	if last := follower.LastLogIndex(); last != 3 {
+		t.Errorf("log grew to %d on a refused request", last)
+	}
+}
+
+func TestAppendEntryRejectsBadTermOrder(t *testing.T) {
+	tests := map[string]struct {
+		prevTerm Term
+		terms    []Term
+	}{
+		"decreasing terms":             {prevTerm: 1, terms: []Term{2, 1}},
+		"entry past the request term":  {prevTerm: 1, terms: []Term{2, 4}},
+		"entry before the prior entry": {prevTerm: 2, terms: []Term{1}},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			modules, _ := newCluster(t, 3)
+			follower := modules[1]
+			appendTerms(follower, test.prevTerm)
+			request := AppendEntries[string]{Term: 3, LeaderId: 1, PrevLogIndex: 2, PrevLogTerm: test.prevTerm}
+			for _, term := range test.terms {
+				request.Entries = append(request.Entries, LogEntry[string]{Term: term, Command: "SET"})
+			}
+			if reply := follower.AppendEntry(request); reply.Success {
+				t.Errorf("AppendEntry = %+v, want a refusal", reply)
+			}
+			if got, want := logTerms(follower), []Term{0, test.prevTerm}; !slices.Equal(got, want) {
+				t.Errorf("log terms %v after a refused request, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestSeedReproducesTicks(t *testing.T) {
+	ticks := func(seed int64) []time.Duration {
+		module, err := NewInMemoryNetwork[string, int, bool]().Add(1, NewMemoryStorage[string](), WithSeed(seed))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer module.Close()
+		module.Mutex.Lock()
+		defer module.Mutex.Unlock()
+		var durations []time.Duration
+		for i := 0; i < 20; i++ {
+			module.setTicker()
+			durations = append(durations, module.TickerDuration)
+		}
+		return durations
+	}
+	first := ticks(42)
+	if again := ticks(42); !slices.Equal(again, first) {
+		t.Errorf("seed 42 gave %v, then %v", first, again)
+	}
+	if other := ticks(43); slices.Equal(other, first) {
+		t.Errorf("seeds 42 and 43 both gave %v", first)
+	}
+}
+
+func TestAppendEntryHigherTerm(t *testing.T) {
+	for _, state := range []ConsensusModuleState{Follower, Candidate, Leader} {
+		t.Run(state.String(), func(t *testing.T) {
+			modules, _ := newCluster(t, 3)
+			node := modules[1]
+			setTerm(node, 2, int(node.Id))
+			node.Mutex.Lock()
+			node.State = state
+			node.Mutex.Unlock()
+			reply := node.AppendEntry(AppendEntries[string]{
+				Term:         5,
+				LeaderId:     1,
+				PrevLogIndex: 1,
+				Entries:      []LogEntry[string]{{Term: 5, Command: "SET a 1"}},
+			})
+			if !reply.Success || reply.Term != 5 {
+				t.Errorf("reply = %+v, want success in term 5", reply)
+			}
+			term, _, now := node.GetState()
+			node.Mutex.Lock()
+			votedFor := node.VotedFor
+			node.Mutex.Unlock()
+			if term != 5 || now != Follower || votedFor != -1 {
+				t.Errorf("term %d, %v voting for %d; want a follower in term 5 with no vote", term, now, votedFor)
+			}
+			if got := logTerms(node); !slices.Equal(got, []Term{0, 5}) {
+				t.Errorf("log terms %v, want [0 5]", got)
+			}
+		})
+	}
+}
+
+func TestLogAccessors(t *testing.T) {
+	modules, _ := newCluster(t, 3)
+	follower := modules[1]
+	check := func(when string, index Index, term Term, commit Index) {
+		t.Helper()
+		if got := follower.LastLogIndex(); got != index {
+			t.Errorf("%s: LastLogIndex = %d, want %d", when, got, index)
+		}
+		if got := follower.LastLogTerm(); got != term {
+			t.Errorf("%s: LastLogTerm = %d, want %d", when, got, term)
+		}
+		if got := follower.GetCommitIndex(); got != commit {
+			t.Errorf("%s: GetCommitIndex = %d, want %d", when, got, commit)
+		}
+	}
+	check("fresh", 1, 0, 1)
+	follower.AppendEntry(AppendEntries[string]{
+		Term:         2,
+		LeaderId:     1,
+		PrevLogIndex: 1,
+		Entries:      []LogEntry[string]{{Term: 1, Command: "SET a 1"}, {Term: 2, Command: "SET b 2"}},
+	})
+	check("after appending", 3, 2, 1)
+	follower.AppendEntry(AppendEntries[string]{Term: 2, LeaderId: 1, PrevLogIndex: 3, PrevLogTerm: 2, LeaderCommit: 2})
+	check("after committing", 3, 2, 2)
+}
+
+func TestConcurrentProposals(t *testing.T) {
+	const goroutines, each = 16, 50
+	modules, _ := startCluster(t, 3, quiet)
+	drain(modules...)
+	leader := modules[0]
+	leader.ForceElection()
+	first := leader.LastLogIndex() + 1
+	indices := make(chan Index, goroutines*each)
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < each; i++ {
+				index, _, isLeader := leader.Propose(fmt.Sprintf("SET %d %d", g, i))
+				if !isLeader {
+					t.Error("the leader refused a proposal")
+					return
+				}
+				indices <- index
+			}
+		}(g)
+	}
+	wg.Wait()
+	close(indices)
+
+	var got []Index
+	for index := range indices {
+		got = append(got, index)
+	}
+	slices.Sort(got)
+	for i, index := range got {
+		if index != first+Index(i) {
+			t.Fatalf("proposal %d of %d got index %d, want %d: the indices have a gap or repeat", i+1, len(got), index, first+Index(i))
+		}
+	}
+	if last := leader.LastLogIndex(); last != first+goroutines*each-1 {
+		t.Errorf("log ends at %d, want %d", last, first+goroutines*each-1)
+	}
+	waitCommitted(t, modules, first+goroutines*each-1)
+}
+
+func TestStickinessRefusesDisruptiveVote(t *testing.T) {
+	for _, sticky := range []bool{true, false} {
+		clock := NewManualClock(time.Unix(0, 0))
+		modules, _ := newCluster(t, 3, WithClock(clock), WithElectionTimeout(time.Second, time.Second), WithLeaderStickiness(sticky))
+		follower := modules[1]
+		follower.AppendEntry(AppendEntries[string]{Term: 1, LeaderId: 1, PrevLogIndex: 1})
+		// Node 3 skips Pre-Vote and asks straight for a vote in a new term.
+		disruptive := RequestVote[string]{Term: 2, CandidateId: 3, LastLogIndex: 1}
+		clock.Advance(500 * time.Millisecond)
+		reply := follower.Vote(disruptive)
+		term, _, _ := follower.GetState()
+		if reply.VoteGranted == sticky || (sticky && term != 1) {
+			t.Errorf("stickiness %v: vote just after a heartbeat granted %v, term %d", sticky, reply.VoteGranted, term)
+		}
+		if !sticky {
+			continue
+		}
+		clock.Advance(500 * time.Millisecond)
+		if reply := follower.Vote(disruptive); !reply.VoteGranted {
+			t.Errorf("vote an election timeout after the last heartbeat refused: %+v", reply)
+		}
+	}
+}
+
+func TestDuplicateAppendEntries(t *testing.T) {
+	modules, _ := newCluster(t, 3)
+	follower := modules[1]
+	first := AppendEntries[string]{
+		Term:         2,
+		LeaderId:     1,
+		PrevLogIndex: 1,
+		Entries:      []LogEntry[string]{{Term: 1, Command: "SET a 1"}, {Term: 2, Command: "SET b 2"}},
+		LeaderCommit: 2,
+	}
+	follower.AppendEntry(first)
+	wantTerms, wantCommit := logTerms(follower), follower.GetCommitIndex()
+	for i := 0; i < 2; i++ {
+		if reply := follower.AppendEntry(first); !reply.Success {
+			t.Fatalf("retransmission %d refused: %+v", i+1, reply)
+		}
+		if got := logTerms(follower); !slices.Equal(got, wantTerms) {
+			t.Errorf("log terms %v after retransmission %d, want %v", got, i+1, wantTerms)
+		}
+		if got := follower.GetCommitIndex(); got != wantCommit {
+			t.Errorf("commit index %d after retransmission %d, want %d", got, i+1, wantCommit)
+		}
+	}
+
+	// A later request moves the follower on; the first one arriving late
+	// must not take it back.
+	later := AppendEntries[string]{
+		Term:         2,
+		LeaderId:     1,
+		PrevLogIndex: 3,
+		PrevLogTerm:  2,
+		Entries:      []LogEntry[string]{{Term: 2, Command: "SET c 3"}},
+		LeaderCommit: 4,
+	}
+	follower.AppendEntry(later)
+	follower.AppendEntry(first)
+	if got, want := logTerms(follower), []Term{0, 1, 2, 2}; !slices.Equal(got, want) {
+		t.Errorf("log terms %v after a late retransmission, want %v", got, want)
+	}
+	if got := follower.GetCommitIndex(); got != 4 {
+		t.Errorf("commit index %d after a late retransmission, want 4", got)
+	}
+}
+
+func TestRepliesKeepRPCsApart(t *testing.T) {
+	modules, _ := newCluster(t, 3)
+	node := modules[1]
+	if reply := node.Vote(RequestVote[string]{Term: 1, CandidateId: 1, LastLogIndex: 1}); !reply.VoteGranted || reply.Success {
+		t.Errorf("vote reply = %+v, want VoteGranted alone", reply)
+	}
+	if reply := node.AppendEntry(AppendEntries[string]{Term: 1, LeaderId: 1, PrevLogIndex: 1}); !reply.Success || reply.VoteGranted {
+		t.Errorf("AppendEntries reply = %+v, want Success alone", reply)
+	}
+}
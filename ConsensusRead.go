@@ -0,0 +1,162 @@
+package raft
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// leaseSkew is the share of the lease given up to allow for our clock running
+// slower than a follower's.
+const leaseSkew = 10
+
+// ReadIndex returns an index that is safe to serve a linearizable read at.
+// It records CommitIndex, confirms we are still leader by exchanging a round
+// of heartbeats with a majority and then waits for the state machine to
+// apply up to the recorded index, or for ctx to be done. A leader that has
+// not yet committed an entry in its own term cannot know the real commit
+// index and is refused, as is one whose leadership cannot be confirmed.
+func (c *ConsensusModule[j, x, k]) ReadIndex(ctx context.Context) (Index, error) {
+	peers := c.peerIds()
+	c.Mutex.Lock()
+	if c.State != Leader {
+		err := c.notLeader()
+		c.Mutex.Unlock()
+		return 0, err
+	}
+	if c.termAt(c.CommitIndex) != c.CurrentTerm {
+		c.Mutex.Unlock()
+		return 0, ErrNotReady
+	}
+	readIndex, term := c.CommitIndex, c.CurrentTerm
+	requests := make(map[uint]AppendEntries[j], len(peers))
+	for _, peer := range peers {
+		requests[peer] = c.NewHeartbeat(peer)
+	}
+	c.Mutex.Unlock()
+	start := c.Config.Clock.Now()
+
+	rpcCtx, cancel := c.rpcContext(c.Config.HeartbeatIntervalMax)
+	replies := c.Contact.AppendEntries(rpcCtx, requests)
+	cancel()
+
+	c.Mutex.Lock()
+	defer c.Mutex.Unlock()
+	acks := 1
+	for peer, reply := range replies {
+		if _, ok := requests[peer]; !ok {
+			continue
+		}
+		if reply.Term > c.CurrentTerm {
+			c.becomeFollower(reply.Term)
+		}
+		if reply.Term == term {
+			acks++
+		}
+	}
+	if c.State != Leader || c.CurrentTerm != term {
+		return 0, c.notLeader()
+	}
+	if acks < quorum(peers) {
+		return 0, ErrLeadershipUnconfirmed
+	}
+	c.renewLease(start, acks, peers)
+	if err := c.waitForApply(ctx, readIndex, 0); err != nil {
+		return 0, err
+	}
+	return readIndex, nil
+}
+
+// ReadAfter is ReadIndex for a client that has just written at index, as
+// returned by Propose: it first waits for that entry to be applied, so the
+// read that follows is sure to see the write. It fails as WaitForApply does
+// when the entry was overwritten or ctx is done, and as ReadIndex does
+// otherwise.
+func (c *ConsensusModule[j, x, k]) ReadAfter(ctx context.Context, index Index) (Index, error) {
+	if err := c.WaitForApply(ctx, index); err != nil {
+		return 0, err
+	}
+	return c.ReadIndex(ctx)
+}
+
+// LeaseRead is a cheaper ReadIndex that trusts the lease from the last
+// heartbeat round a majority answered instead of exchanging new messages.
+// It relies on followers refusing pre-votes for ElectionTimeoutMin after
+// hearing from us, so no lease is held with pre-vote disabled or while
+// leadership is being handed over. Like ReadIndex, it gives up waiting for
+// the state machine when ctx is done.
+func (c *ConsensusModule[j, x, k]) LeaseRead(ctx context.Context) (Index, error) {
+	c.Mutex.Lock()
+	defer c.Mutex.Unlock()
+	if c.State != Leader {
+		return 0, c.notLeader()
+	}
+	if c.termAt(c.CommitIndex) != c.CurrentTerm {
+		return 0, ErrNotReady
+	}
+	if !c.leaseValid() {
+		return 0, ErrLeaseExpired
+	}
+	readIndex := c.CommitIndex
+	if err := c.waitForApply(ctx, readIndex, 0); err != nil {
+		return 0, err
+	}
+	return readIndex, nil
+}
+
+// renewLease starts a new lease at start, the moment the heartbeat round was
+// sent, if acks, counting ourselves, make up a majority of peers. It expects
+// c.Mutex to be held.
+func (c *ConsensusModule[j, x, k]) renewLease(start time.Time, acks int, peers []uint) {
+	if acks >= quorum(peers) && start.After(c.leaseStart) {
+		c.leaseStart = start
+	}
+}
+
+// leaseValid reports whether we still hold a leader lease. The lease, which
+// NewConsensusModule has checked is below ElectionTimeoutMin, is shortened by
+// leaseSkew percent. It expects c.Mutex to be held.
+func (c *ConsensusModule[j, x, k]) leaseValid() bool {
+	if !c.Config.PreVote || c.transferring || c.leaseStart.IsZero() {
+		return false
+	}
+	lease := c.Config.LeaseDuration
+	lease -= lease * leaseSkew / 100
+	return c.Config.Clock.Now().Sub(c.leaseStart) < lease
+}
+
+// Get returns the entry at index, which may not be committed yet. It fails
+// with ErrCompacted when index has been folded into the snapshot and with
+// ErrIndexOutOfRange when it is zero or past the end of the log.
+func (c *ConsensusModule[j, x, k]) Get(index Index) (LogEntry[j], error) {
+	c.Mutex.Lock()
+	defer c.Mutex.Unlock()
+	if index > 0 && index <= c.LastIncludedIndex {
+		return LogEntry[j]{}, ErrCompacted
+	}
+	entry, ok := c.entryAt(index)
+	if !ok {
+		return LogEntry[j]{}, fmt.Errorf("%w: %d", ErrIndexOutOfRange, index)
+	}
+	return entry, nil
+}
+
+// CommittedEntries returns a copy of the committed entries from index from
+// through CommitIndex, which is empty when from is one past CommitIndex.
+// Entries that may still be overwritten are never included. It fails with
+// ErrCompacted when from has been folded into the snapshot and with
+// ErrIndexOutOfRange when from is past the end of the committed log.
+func (c *ConsensusModule[j, x, k]) CommittedEntries(from Index) ([]LogEntry[j], error) {
+	c.Mutex.Lock()
+	defer c.Mutex.Unlock()
+	if from == 0 || from > c.CommitIndex+1 {
+		return nil, fmt.Errorf("%w: %d", ErrIndexOutOfRange, from)
+	}
+	if from <= c.LastIncludedIndex {
+		return nil, ErrCompacted
+	}
+	start, _ := c.offset(from)
+	end, _ := c.offset(c.CommitIndex)
+	return slices.Clone(c.Log[start : end+1]), nil
+}
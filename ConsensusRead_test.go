@@ -0,0 +1,158 @@
+package raft
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// isolate cuts leader off from the rest of modules and waits for them to
+// elect a new leader, which it returns.
+func isolate(t *testing.T, network *InMemoryNetwork[string, int, bool], modules []*testModule, leader *testModule) *testModule {
+	t.Helper()
+	var rest []*testModule
+	var ids []uint
+	for _, module := range modules {
+		if module != leader {
+			rest = append(rest, module)
+			ids = append(ids, module.Id)
+		}
+	}
+	network.Partition([][]uint{{leader.Id}, ids})
+	return waitLeader(t, rest)
+}
+
+func TestReadIndexDeposedLeader(t *testing.T) {
+	modules, network := startCluster(t, 3)
+	leader := waitLeader(t, modules)
+	index, _, _ := leader.Propose("SET a 1")
+	waitCommitted(t, modules, index)
+	if _, err := leader.ReadIndex(context.Background()); err != nil {
+		t.Fatalf("ReadIndex on the leader: %v", err)
+	}
+
+	successor := isolate(t, network, modules, leader)
+	index, _, _ = successor.Propose("SET a 2")
+	waitCommitted(t, []*testModule{successor}, index)
+	// The old leader still believes it leads, but no majority answers it.
+	if _, err := leader.ReadIndex(context.Background()); !errors.Is(err, ErrLeadershipUnconfirmed) && !errors.Is(err, ErrNotLeader) {
+		t.Errorf("ReadIndex on the deposed leader = %v, want it refused", err)
+	}
+	network.Heal()
+	waitFor(t, "the deposed leader to step down", func() bool {
+		_, err := leader.ReadIndex(context.Background())
+		return errors.Is(err, ErrNotLeader)
+	})
+}
+
+func TestLeaseReadExpires(t *testing.T) {
+	modules, network := startCluster(t, 3)
+	leader := waitLeader(t, modules)
+	index, _, _ := leader.Propose("SET a 1")
+	waitCommitted(t, modules, index)
+	waitFor(t, "a lease", func() bool {
+		_, err := leader.LeaseRead(context.Background())
+		return err == nil
+	})
+
+	// Without a majority answering heartbeats the lease is not renewed. It
+	// runs out after LeaseDuration, well before the others can elect a new
+	// leader, which would by then be free to accept writes.
+	isolate(t, network, modules, leader)
+	if _, err := leader.LeaseRead(context.Background()); !errors.Is(err, ErrLeaseExpired) {
+		t.Errorf("LeaseRead after the lease ran out = %v, want ErrLeaseExpired", err)
+	}
+}
+
+func TestReadsGiveUpWithContext(t *testing.T) {
+	modules, _ := startCluster(t, 3, WithBufferSize(1))
+	leader := waitLeader(t, modules)
+	// Nothing reads ReceiveChan, so the leader applies no further than the
+	// first entry while the rest commit.
+	var index Index
+	for i := 0; i < 5; i++ {
+		index, _, _ = leader.Propose(fmt.Sprintf("SET k %d", i))
+	}
+	waitCommitted(t, modules, index)
+	waitFor(t, "a lease", func() bool {
+		leader.Mutex.Lock()
+		defer leader.Mutex.Unlock()
+		return leader.leaseValid()
+	})
+	reads := map[string]func(context.Context) (Index, error){
+		"ReadIndex": leader.ReadIndex,
+		"LeaseRead": leader.LeaseRead,
+	}
+	for name, read := range reads {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		_, err := read(ctx)
+		cancel()
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("%s behind a stalled apply loop = %v, want the deadline", name, err)
+		}
+	}
+	drain(modules...)
+}
+
+func TestCommittedEntriesExcludesUncommitted(t *testing.T) {
+	modules, _ := newCluster(t, 3)
+	module := modules[0]
+	appendTerms(module, 1, 1, 2, 2)
+	module.Mutex.Lock()
+	module.CommitIndex = 3
+	module.Mutex.Unlock()
+
+	entries, err := module.CommittedEntries(2)
+	if err != nil || len(entries) != 2 || entries[0].Term != 1 || entries[1].Term != 1 {
+		t.Errorf("CommittedEntries(2) = %v, %v; want the entries at 2 and 3", entries, err)
+	}
+	if entries, err := module.CommittedEntries(4); err != nil || len(entries) != 0 {
+		t.Errorf("CommittedEntries(4) = %v, %v; want nothing", entries, err)
+	}
+	for _, from := range []Index{0, 5} {
+		if entries, err := module.CommittedEntries(from); !errors.Is(err, ErrIndexOutOfRange) {
+			t.Errorf("CommittedEntries(%d) = %v, %v; want ErrIndexOutOfRange", from, entries, err)
+		}
+	}
+}
+
+func TestGetOutOfRange(t *testing.T) {
+	modules, _ := newCluster(t, 3)
+	module := modules[0]
+	appendTerms(module, 1)
+	// Index is unsigned, so zero stands in for a negative index.
+	for _, index := range []Index{0, 3, 100} {
+		if _, err := module.Get(index); !errors.Is(err, ErrIndexOutOfRange) {
+			t.Errorf("Get(%d) = %v, want ErrIndexOutOfRange", index, err)
+		}
+	}
+	if entry, err := module.Get(2); err != nil || entry.Term != 1 {
+		t.Errorf("Get(2) = %v, %v; want the entry in term 1", entry, err)
+	}
+	if _, err := compacted(t).Get(2); !errors.Is(err, ErrCompacted) {
+		t.Errorf("Get of a compacted index = %v, want ErrCompacted", err)
+	}
+}
+
+func TestReadAfterSeesWrite(t *testing.T) {
+	modules, fsms, _ := startFSMCluster(t, 3, quiet)
+	modules[0].ForceElection()
+	leader, fsm := modules[0], fsms[0]
+	ctx, cancel := context.WithTimeout(context.Background(), waitTimeout)
+	defer cancel()
+	for i := 0; i < 20; i++ {
+		want := fmt.Sprint(i)
+		index, _, isLeader := leader.Propose("SET x " + want)
+		if !isLeader {
+			t.Fatal("the leader refused a proposal")
+		}
+		if _, err := leader.ReadAfter(ctx, index); err != nil {
+			t.Fatalf("ReadAfter(%d) = %v", index, err)
+		}
+		if got := fsm.get("x"); got != want {
+			t.Fatalf("read x = %q right after writing %q", got, want)
+		}
+	}
+}
@@ -1,21 +1,158 @@
 package raft
 
+import "context"
+
+// RunServer runs the consensus loop on the calling goroutine until done
+// fires or the module is closed. It returns at once on a closed module.
 func (c *ConsensusModule[j, k, x]) RunServer(done <-chan bool) {
-main:
-	for {
+	ctx, cancel, ok := c.begin(context.Background())
+	if !ok {
+		return
+	}
+	c.spawn(func() {
 		select {
 		case <-done:
-			break main
-		case <-*c.ReceiveChan:
-			c.ResetTicker()
-		case <-c.Ticker.C:
-			if c.State == Follower {
-				c.followerToCandidate()
-			} else if c.State == Leader {
-				c.handleLeader()
-			} else {
-				c.State = Follower
-			}
+			cancel()
+		case <-ctx.Done():
+		}
+	})
+	c.electAlone(ctx)
+	c.run(ctx)
+}
+
+// Start runs the consensus loop in its own goroutine until ctx is cancelled
+// or the module is closed, stopping the ticker on the way out. Starting a
+// closed module does nothing.
+func (c *ConsensusModule[j, k, x]) Start(ctx context.Context) {
+	ctx, _, ok := c.begin(ctx)
+	if !ok {
+		return
+	}
+	c.electAlone(ctx)
+	go c.run(ctx)
+}
+
+// Close stops the module: it cancels the run loop, waits for every goroutine
+// the module started to exit, stops the ticker and closes ReceiveChan,
+// ApplyBatchChan and the LeaderChanges channel, so an application ranging
+// over them sees the end once it has read what was already delivered.
+// Calls blocked in ReadIndex, LeaseRead or WaitForApply return ErrClosed.
+// Closing more than once is a no-op.
+func (c *ConsensusModule[j, k, x]) Close() {
+	c.closeOnce.Do(func() {
+		c.Mutex.Lock()
+		c.closed = true
+		cancel := c.cancel
+		c.applied.Broadcast()
+		c.Mutex.Unlock()
+		if cancel != nil {
+			cancel()
+		}
+		c.workers.Wait()
+		c.Mutex.Lock()
+		c.stopTicker()
+		c.Mutex.Unlock()
+		close(c.ReceiveChan)
+		close(c.ApplyBatchChan)
+		close(c.leaderChanges)
+	})
+}
+
+// begin derives the context the module's goroutines run under from parent,
+// restarts the ticker a previous run loop stopped and starts the apply,
+// metrics and leadership loops, counting the run loop in c.workers too. It
+// starts nothing and reports false once the module has been closed, when the
+// caller must not start the run loop either.
+func (c *ConsensusModule[j, k, x]) begin(parent context.Context) (context.Context, context.CancelFunc, bool) {
+	ctx, cancel := context.WithCancel(parent)
+	c.Mutex.Lock()
+	defer c.Mutex.Unlock()
+	if c.closed {
+		cancel()
+		return ctx, cancel, false
+	}
+	c.cancel = cancel
+	c.tickerStopped = false
+	c.metricsLoops++
+	c.resetTicker()
+	c.workers.Add(4)
+	go func() {
+		defer c.workers.Done()
+		c.applyLoop(ctx)
+	}()
+	go func() {
+		defer c.workers.Done()
+		c.metricsLoop(ctx)
+	}()
+	go func() {
+		defer c.workers.Done()
+		c.leadershipLoop(ctx)
+	}()
+	return ctx, cancel, true
+}
+
+// electAlone makes a node without peers leader straight away instead of
+// after an election timeout, since its own vote is a majority.
+func (c *ConsensusModule[j, k, x]) electAlone(ctx context.Context) {
+	if ctx.Err() == nil && len(c.peerIds()) == 0 {
+		c.startElection()
+	}
+}
+
+// run is the consensus loop. begin has already counted it in c.workers.
+func (c *ConsensusModule[j, k, x]) run(ctx context.Context) {
+	defer c.workers.Done()
+	defer func() {
+		c.Mutex.Lock()
+		c.stopTicker()
+		c.Mutex.Unlock()
+	}()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-c.Ticker.C():
+			c.tick()
+		case <-c.replicate:
+			c.replicateNow()
+		case <-c.timeoutNow:
+			c.runElection(true)
+		case <-c.campaign:
+			c.campaignNow()
 		}
 	}
 }
+
+// tick handles the ticker firing: a leader sends its heartbeats, and a
+// follower or candidate stands for election in a new term. A candidate whose
+// election was split, and so won no majority, gets here once the fresh
+// random timeout runElection set has expired, so split votes are retried
+// with backoff until one candidate wins.
+func (c *ConsensusModule[j, k, x]) tick() {
+	c.Mutex.Lock()
+	state := c.State
+	c.Mutex.Unlock()
+	if state == Leader {
+		c.spawn(c.handleLeader)
+	} else {
+		c.followerToCandidate()
+	}
+}
+
+func (c *ConsensusModule[j, k, x]) replicateNow() {
+	c.Mutex.Lock()
+	state := c.State
+	c.Mutex.Unlock()
+	if state == Leader {
+		c.spawn(c.handleLeader)
+	}
+}
+
+// spawn runs f in a goroutine that Close waits for.
+func (c *ConsensusModule[j, k, x]) spawn(f func()) {
+	c.workers.Add(1)
+	go func() {
+		defer c.workers.Done()
+		f()
+	}()
+}
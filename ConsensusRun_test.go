@@ -0,0 +1,157 @@
+package raft
+
+import (
+	"context"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStartAfterClose(t *testing.T) {
+	module, err := NewInMemoryNetwork[string, int, bool]().Add(1, NewMemoryStorage[string]())
+	if err != nil {
+		t.Fatal(err)
+	}
+	module.Close()
+
+	module.Start(context.Background())
+	returned := make(chan struct{})
+	go func() {
+		module.RunServer(make(chan bool))
+		close(returned)
+	}()
+	select {
+	case <-returned:
+	case <-time.After(time.Second):
+		t.Fatal("RunServer on a closed module did not return")
+	}
+	// A single node elects itself as soon as it starts, so a closed module
+	// that was really started would now lead.
+	time.Sleep(10 * time.Millisecond)
+	if _, isLeader, _ := module.GetState(); isLeader {
+		t.Error("closed module was started and elected itself")
+	}
+}
+
+// moduleGoroutines returns the stacks of the goroutines running code from
+// this package, other than the tests themselves, keyed by goroutine header.
+func moduleGoroutines() map[string]string {
+	buf := make([]byte, 1<<20)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+	goroutines := make(map[string]string)
+	for _, stack := range strings.Split(string(buf), "\n\n") {
+		header, _, _ := strings.Cut(stack, "\n")
+		if strings.Contains(stack, "raft-go.(*") && !strings.Contains(stack, "raft-go.Test") {
+			goroutines[header] = stack
+		}
+	}
+	return goroutines
+}
+
+func TestCloseLeavesNoGoroutines(t *testing.T) {
+	before := moduleGoroutines()
+	modules, _, err := NewCluster[string, int, bool](3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	for _, module := range modules {
+		module.Start(ctx)
+	}
+	leader := waitLeader(t, modules)
+	leader.Propose("SET 1")
+	waitCommitted(t, modules, 3)
+	for _, module := range modules {
+		module.Close()
+		module.Close()
+	}
+
+	var leaked map[string]string
+	deadline := time.Now().Add(waitTimeout)
+	for {
+		leaked = moduleGoroutines()
+		for header := range before {
+			delete(leaked, header)
+		}
+		if len(leaked) == 0 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	for _, stack := range leaked {
+		t.Errorf("goroutine still running after Close:\n%s", stack)
+	}
+}
+
+func TestTickerUnderChurn(t *testing.T) {
+	modules, _ := startCluster(t, 3,
+		WithElectionTimeout(20*time.Millisecond, 40*time.Millisecond),
+		WithHeartbeatInterval(2*time.Millisecond, 5*time.Millisecond),
+		WithLeaseDuration(10*time.Millisecond))
+	drain(modules...)
+	deadline := time.Now().Add(300 * time.Millisecond)
+	done := make(chan struct{})
+	for _, module := range modules {
+		go func(module *testModule) {
+			defer func() { done <- struct{}{} }()
+			for time.Now().Before(deadline) {
+				module.ForceElection()
+				term, _, _ := module.GetState()
+				// A heartbeat from a leader of a later term, the kind that
+				// resets the ticker from under the run loop.
+				module.AppendEntry(AppendEntries[string]{Term: term + 1, LeaderId: module.Id%3 + 1, PrevLogIndex: 1})
+				tickerDuration(module)
+			}
+		}(module)
+	}
+	for range modules {
+		<-done
+	}
+	// Closing stops the ticker while heartbeats may still be resetting it.
+	for _, module := range modules {
+		go func(module *testModule) {
+			defer func() { done <- struct{}{} }()
+			module.AppendEntry(AppendEntries[string]{Term: 1 << 20, LeaderId: 1, PrevLogIndex: 1})
+		}(module)
+		module.Close()
+	}
+	for range modules {
+		<-done
+	}
+}
+
+func TestCancelStopsRunLoop(t *testing.T) {
+	modules, network := newCluster(t, 3,
+		WithElectionTimeout(20*time.Millisecond, 40*time.Millisecond),
+		WithHeartbeatInterval(2*time.Millisecond, 5*time.Millisecond),
+		WithLeaseDuration(10*time.Millisecond),
+		WithPreVote(false))
+	network.Partition([][]uint{{1}, {2, 3}})
+	module := modules[0]
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	module.Start(ctx)
+	// Cut off from a quorum, the node can only keep campaigning as its
+	// ticker fires.
+	waitFor(t, "the ticker to start elections", func() bool {
+		term, _, _ := module.GetState()
+		return term >= 2
+	})
+
+	cancel()
+	time.Sleep(50 * time.Millisecond)
+	before, _, _ := module.GetState()
+	time.Sleep(200 * time.Millisecond)
+	if after, _, _ := module.GetState(); after != before {
+		t.Errorf("term moved from %d to %d after the context was cancelled", before, after)
+	}
+}
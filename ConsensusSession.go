@@ -0,0 +1,111 @@
+package raft
+
+import (
+	"encoding/json"
+	"maps"
+)
+
+// ClientSession is the last request of a client to have been applied: its
+// sequence number, the index and term of the entry that carried it and what
+// the FSM's Apply returned for it. The result is only kept in memory, so it
+// is nil in a session restored from a snapshot.
+type ClientSession struct {
+	Seq    uint
+	Index  Index
+	Term   Term
+	Result any `json:"-"`
+}
+
+// ProposeOnce is Propose for a client that retries. clientId names the
+// client and seq numbers its requests, which increase with at most one
+// outstanding at a time. A request at or below the client's last applied seq
+// is not appended again; the index and term that applied the last one are
+// returned instead, so WaitForApply returns at once. Should a retry reach the
+// log twice anyway, as when the first leader fails before answering, the
+// apply loop delivers only the first. A zero clientId is not tracked.
+// ProposeOnceApply also returns the request's result, on retries too.
+func (c *ConsensusModule[j, x, k]) ProposeOnce(clientId, seq uint, command j) (index Index, term Term, isLeader bool) {
+	peers := c.peerIds()
+	c.Mutex.Lock()
+	defer c.Mutex.Unlock()
+	if c.State == Leader && !c.transferring && clientId != 0 {
+		if session, ok := c.sessions[clientId]; ok && seq <= session.Seq {
+			return session.Index, session.Term, true
+		}
+	}
+	return c.propose(peers, LogEntry[j]{
+		Command:  command,
+		ClientId: clientId,
+		Seq:      seq,
+	})
+}
+
+// duplicate reports whether entry retries a request already applied.
+func duplicate[j any](sessions map[uint]ClientSession, entry LogEntry[j]) bool {
+	if entry.ClientId == 0 {
+		return false
+	}
+	session, ok := sessions[entry.ClientId]
+	return ok && entry.Seq <= session.Seq
+}
+
+// recordSession notes that the command delivered in message was applied with
+// result. It expects c.Mutex to be held.
+func (c *ConsensusModule[j, x, k]) recordSession(message ApplyMsg[j], result any) {
+	if message.ClientId == 0 {
+		return
+	}
+	if c.sessions == nil {
+		c.sessions = make(map[uint]ClientSession)
+	}
+	c.sessions[message.ClientId] = ClientSession{
+		Seq:    message.Seq,
+		Index:  message.Index,
+		Term:   message.Term,
+		Result: result,
+	}
+}
+
+// sessionsAt works out the sessions as of index, which the application may
+// snapshot at after LastApplied has moved on, by replaying the entries since
+// the last snapshot. Results, which there is no replaying, are left out. It
+// expects c.Mutex to be held.
+func (c *ConsensusModule[j, x, k]) sessionsAt(index Index) map[uint]ClientSession {
+	sessions := maps.Clone(c.snapshotSessions)
+	for i := c.LastIncludedIndex + 1; i <= index; i++ {
+		entry, _ := c.entryAt(i)
+		if entry.Type != CommandEntry || entry.ClientId == 0 || duplicate(sessions, entry) {
+			continue
+		}
+		if sessions == nil {
+			sessions = make(map[uint]ClientSession)
+		}
+		sessions[entry.ClientId] = ClientSession{
+			Seq:   entry.Seq,
+			Index: i,
+			Term:  entry.Term,
+		}
+	}
+	return sessions
+}
+
+// snapshotState is what is saved to Storage for a snapshot: the
+// application's state along with the sessions, so that retries are still
+// recognised after a restart, and the configuration as of the snapshot,
+// whose entry the snapshot may have compacted away.
+type snapshotState struct {
+	Sessions      map[uint]ClientSession `json:",omitempty"`
+	Configuration []uint                 `json:",omitempty"`
+	Learners      []uint                 `json:",omitempty"`
+	Data          []byte
+}
+
+func encodeSnapshot(state snapshotState) ([]byte, error) {
+	return json.Marshal(state)
+}
+
+func decodeSnapshot(encoded []byte) (snapshotState, error) {
+	var state snapshotState
+	err := json.Unmarshal(encoded, &state)
+	return state, err
+}
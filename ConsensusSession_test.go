@@ -0,0 +1,75 @@
+package raft
+
+import (
+	"context"
+	"testing"
+)
+
+func TestProposeOnceApplyRetry(t *testing.T) {
+	modules, fsms, network := startFSMCluster(t, 3)
+	leader := waitLeader(t, modules)
+	ctx := context.Background()
+	if _, err := leader.ProposeApply(ctx, "SET x 1"); err != nil {
+		t.Fatal(err)
+	}
+	result, err := leader.ProposeOnceApply(ctx, 7, 1, "SET x 2")
+	if err != nil || result != "1" {
+		t.Fatalf("ProposeOnceApply = %v, %v, want 1", result, err)
+	}
+	waitCommitted(t, modules, leader.LastLogIndex())
+
+	// The client hears nothing back and retries after the command committed:
+	// first with the same leader, then with the one elected after it fails.
+	if result, err := leader.ProposeOnceApply(ctx, 7, 1, "SET x 2"); err != nil || result != "1" {
+		t.Errorf("retry with the same leader = %v, %v, want the cached 1", result, err)
+	}
+	var others []*testModule
+	for _, module := range modules {
+		if module != leader {
+			others = append(others, module)
+		}
+	}
+	network.Partition([][]uint{{others[0].Id, others[1].Id}})
+	successor := waitLeader(t, others)
+	if result, err := successor.ProposeOnceApply(ctx, 7, 1, "SET x 2"); err != nil || result != "1" {
+		t.Errorf("retry with the new leader = %v, %v, want the cached 1", result, err)
+	}
+
+	for i, fsm := range fsms {
+		if applied := fsm.count(); modules[i] != leader && applied != 2 {
+			t.Errorf("node %d applied %d commands, want 2", modules[i].Id, applied)
+		}
+	}
+}
+
+func TestProposeOnceApplyDuplicateInLog(t *testing.T) {
+	modules, fsms, _ := startFSMCluster(t, 1)
+	leader := waitLeader(t, modules)
+	ctx := context.Background()
+	if _, err := leader.ProposeApply(ctx, "SET x 1"); err != nil {
+		t.Fatal(err)
+	}
+	// A retry that reached the log before the first copy was applied, as
+	// when a leader fails after appending it, is appended twice.
+	leader.Mutex.Lock()
+	first, _, _ := leader.propose(nil, LogEntry[string]{Command: "SET x 2", ClientId: 7, Seq: 1})
+	leader.Mutex.Unlock()
+	if err := leader.WaitForApply(ctx, first); err != nil {
+		t.Fatal(err)
+	}
+	leader.Mutex.Lock()
+	second, _, _ := leader.propose(nil, LogEntry[string]{Command: "SET x 2", ClientId: 7, Seq: 1})
+	leader.Mutex.Unlock()
+	if err := leader.WaitForApply(ctx, second); err != nil {
+		t.Fatal(err)
+	}
+	leader.Mutex.Lock()
+	result := leader.sessionResult(7, 1)
+	leader.Mutex.Unlock()
+	if result != "1" {
+		t.Errorf("session result = %v, want 1 from the first copy", result)
+	}
+	if applied := fsms[0].count(); applied != 2 {
+		t.Errorf("applied %d commands, want the retry applied only once", applied)
+	}
+}
@@ -0,0 +1,152 @@
+package raft
+
+import (
+	"maps"
+	"slices"
+)
+
+// Snapshot compacts the log up to and including index, which the application
+// has already applied and captured in state. Indices at or before the current
+// snapshot are ignored.
+func (c *ConsensusModule[j, x, k]) Snapshot(index Index, state []byte) error {
+	c.Mutex.Lock()
+	defer c.Mutex.Unlock()
+	if index <= c.LastIncludedIndex {
+		return nil
+	}
+	if index > c.LastApplied {
+		return ErrNotApplied
+	}
+	position, _ := c.offset(index)
+	term := c.termAt(index)
+	sessions := c.sessionsAt(index)
+	voters, learners := c.configurationAt(index)
+	if err := c.persistSnapshot(index, term, snapshotState{Sessions: sessions, Configuration: voters, Learners: learners, Data: state}); err != nil {
+		return err
+	}
+	c.snapshotSessions = sessions
+	c.snapshotConfiguration, c.snapshotLearners = voters, learners
+	c.LastIncludedTerm = term
+	c.Log = append([]LogEntry[j]{}, c.Log[position+1:]...)
+	c.LastIncludedIndex = index
+	c.snapshot = state
+	return c.persistLog()
+}
+
+// maybeSnapshot takes a snapshot through Config.SnapshotFunc, or the FSM
+// without one, once Config.SnapshotThreshold entries have been applied since
+// the last one. A failure is logged and retried after the next entry is
+// applied.
+func (c *ConsensusModule[j, x, k]) maybeSnapshot() {
+	snapshot := c.Config.SnapshotFunc
+	if snapshot == nil && c.fsm != nil {
+		snapshot = c.fsmSnapshot
+	}
+	c.Mutex.Lock()
+	threshold := Index(max(c.Config.SnapshotThreshold, 0))
+	due := snapshot != nil && threshold > 0 && c.LastApplied >= c.LastIncludedIndex+threshold
+	c.Mutex.Unlock()
+	if !due {
+		return
+	}
+	index, state, err := snapshot()
+	if err == nil {
+		err = c.Snapshot(index, state)
+	}
+	if err != nil {
+		c.Mutex.Lock()
+		c.warn("automatic snapshot failed", "err", err)
+		c.Mutex.Unlock()
+	}
+}
+
+// InstallSnapshot replaces our log prefix with the leader's snapshot. Entries
+// after the snapshot are kept when they agree with it; otherwise the whole
+// log has been superseded and is dropped. The snapshot is only acknowledged
+// once the log left behind has been saved too.
+func (c *ConsensusModule[j, x, k]) InstallSnapshot(snapshot InstallSnapshot) Reply {
+	c.Mutex.Lock()
+	defer c.Mutex.Unlock()
+	if snapshot.Term < c.CurrentTerm {
+		return Reply{
+			Term:    c.CurrentTerm,
+			Success: false,
+		}
+	}
+	if snapshot.Term > c.CurrentTerm {
+		c.becomeFollower(snapshot.Term)
+	}
+	c.heardFromLeader(snapshot.LeaderId)
+	if snapshot.LastIncludedIndex <= c.LastIncludedIndex {
+		return Reply{
+			Term:    c.CurrentTerm,
+			Success: !c.logUnsaved || c.persistLog() == nil,
+		}
+	}
+	state := snapshotState{
+		Sessions:      snapshot.Sessions,
+		Configuration: snapshot.Configuration,
+		Learners:      snapshot.Learners,
+		Data:          snapshot.Data,
+	}
+	if c.persistSnapshot(snapshot.LastIncludedIndex, snapshot.LastIncludedTerm, state) != nil {
+		return Reply{
+			Term:    c.CurrentTerm,
+			Success: false,
+		}
+	}
+	if position, ok := c.offset(snapshot.LastIncludedIndex); ok && c.Log[position].Term == snapshot.LastIncludedTerm {
+		c.Log = append([]LogEntry[j]{}, c.Log[position+1:]...)
+	} else {
+		c.Log = []LogEntry[j]{}
+	}
+	c.LastIncludedIndex = snapshot.LastIncludedIndex
+	c.LastIncludedTerm = snapshot.LastIncludedTerm
+	c.snapshot = snapshot.Data
+	c.snapshotSessions = maps.Clone(snapshot.Sessions)
+	if snapshot.Configuration != nil {
+		c.snapshotConfiguration, c.snapshotLearners = slices.Clone(snapshot.Configuration), slices.Clone(snapshot.Learners)
+		c.configuration = slices.Clone(snapshot.Configuration)
+		c.learners = slices.Clone(snapshot.Learners)
+	}
+	c.setCommitIndex(snapshot.LastIncludedIndex)
+	c.notifyApply()
+	return Reply{
+		Term:    c.CurrentTerm,
+		Success: c.persistLog() == nil,
+	}
+}
+
+// sendSnapshots ships our snapshot to each peer that needs entries we have
+// already compacted and records how far they have been brought. It expects
+// c.Mutex to be held and releases it around each RPC.
+func (c *ConsensusModule[j, x, k]) sendSnapshots(peers []uint) {
+	for _, peer := range peers {
+		request := InstallSnapshot{
+			Term:              c.CurrentTerm,
+			LeaderId:          c.Id,
+			LastIncludedIndex: c.LastIncludedIndex,
+			LastIncludedTerm:  c.LastIncludedTerm,
+			Configuration:     c.snapshotConfiguration,
+			Learners:          c.snapshotLearners,
+			Sessions:          c.snapshotSessions,
+			Data:              c.snapshot,
+		}
+		c.Mutex.Unlock()
+		ctx, cancel := c.rpcContext(c.Config.ElectionTimeoutMax)
+		reply := c.Contact.InstallSnapshot(ctx, peer, request)
+		cancel()
+		c.Mutex.Lock()
+		if c.State != Leader || c.CurrentTerm != request.Term {
+			return
+		}
+		if reply.Term > c.CurrentTerm {
+			c.becomeFollower(reply.Term)
+			return
+		}
+		if reply.Success {
+			c.MatchIndex[peer] = max(c.MatchIndex[peer], request.LastIncludedIndex)
+			c.NextIndex[peer] = c.MatchIndex[peer] + 1
+		}
+	}
+}
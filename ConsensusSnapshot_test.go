@@ -0,0 +1,301 @@
+package raft
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync/atomic"
+	"testing"
+)
+
+// flakyStorage is a MemoryStorage whose SaveLog fails while failLog is set.
+type flakyStorage struct {
+	*MemoryStorage[string]
+	failLog bool
+}
+
+func (f *flakyStorage) SaveLog(entries []LogEntry[string]) error {
+	if f.failLog {
+		return errors.New("disk full")
+	}
+	return f.MemoryStorage.SaveLog(entries)
+}
+
+func TestInstallSnapshotReportsUnsavedLog(t *testing.T) {
+	storage := &flakyStorage{MemoryStorage: NewMemoryStorage[string]()}
+	module, err := NewInMemoryNetwork[string, int, bool]().Add(2, storage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	snapshot := InstallSnapshot{
+		Term:              1,
+		LeaderId:          1,
+		LastIncludedIndex: 4,
+		LastIncludedTerm:  1,
+		Configuration:     []uint{1, 2},
+	}
+
+	storage.failLog = true
+	if reply := module.InstallSnapshot(snapshot); reply.Success {
+		t.Fatal("InstallSnapshot acknowledged a snapshot whose log was not saved")
+	}
+	if reply := module.InstallSnapshot(snapshot); reply.Success {
+		t.Fatal("retransmitted InstallSnapshot acknowledged while the log is still unsaved")
+	}
+	storage.failLog = false
+	if reply := module.InstallSnapshot(snapshot); !reply.Success {
+		t.Fatal("retransmitted InstallSnapshot refused once the log could be saved")
+	}
+	if index, _, _, _ := storage.LoadSnapshot(); index != 4 {
+		t.Errorf("saved snapshot through %d, want 4", index)
+	}
+}
+
+func TestSnapshotCatchesUpFollower(t *testing.T) {
+	modules, network := startCluster(t, 3, quiet)
+	leader, lagging := modules[0], modules[2]
+	leader.ForceElection()
+	network.SetDropped(leader.Id, lagging.Id, true)
+	var index Index
+	for i := 0; i < 5; i++ {
+		index, _, _ = leader.Propose(fmt.Sprintf("SET k %d", i))
+	}
+	waitCommitted(t, modules[:2], index)
+	waitFor(t, "the leader to apply", func() bool {
+		leader.Mutex.Lock()
+		defer leader.Mutex.Unlock()
+		return leader.LastApplied == index
+	})
+	if err := leader.Snapshot(index, []byte("state")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := leader.Get(index); !errors.Is(err, ErrCompacted) {
+		t.Errorf("Get(%d) after the snapshot = %v, want ErrCompacted", index, err)
+	}
+	if last := leader.LastLogIndex(); last != index {
+		t.Errorf("last log index %d after the snapshot, want %d", last, index)
+	}
+
+	// The entries the lagging follower is missing are gone from the leader's
+	// log, so only the snapshot can bring it up to date.
+	network.SetDropped(leader.Id, lagging.Id, false)
+	for {
+		msg := receive(t, lagging)
+		if msg.SnapshotValid {
+			if msg.Index != index || string(msg.Snapshot) != "state" {
+				t.Errorf("installed snapshot %q through %d, want %q through %d", msg.Snapshot, msg.Index, "state", index)
+			}
+			break
+		}
+	}
+	waitCommitted(t, modules, index)
+	next, _, _ := leader.Propose("SET k after")
+	waitCommitted(t, modules, next)
+}
+
+// compacted returns a follower in term 2 whose log held entries in terms
+// 0, 1, 1, 2 and 2 and has been compacted through index 3.
+func compacted(t *testing.T) *testModule {
+	t.Helper()
+	modules, _ := newCluster(t, 3)
+	follower := modules[0]
+	appendTerms(follower, 1, 1, 2, 2)
+	setTerm(follower, 2, -1)
+	follower.Mutex.Lock()
+	follower.CommitIndex, follower.LastApplied = 5, 5
+	follower.Mutex.Unlock()
+	if err := follower.Snapshot(3, []byte("state")); err != nil {
+		t.Fatal(err)
+	}
+	return follower
+}
+
+func TestGetAfterCompaction(t *testing.T) {
+	follower := compacted(t)
+	for index, want := range map[Index]error{1: ErrCompacted, 3: ErrCompacted, 6: ErrIndexOutOfRange} {
+		if _, err := follower.Get(index); !errors.Is(err, want) {
+			t.Errorf("Get(%d) = %v, want %v", index, err, want)
+		}
+	}
+	for _, index := range []Index{4, 5} {
+		if entry, err := follower.Get(index); err != nil || entry.Term != 2 {
+			t.Errorf("Get(%d) = %v, %v, want the entry in term 2", index, entry, err)
+		}
+	}
+}
+
+func TestPrevLogCheckAfterCompaction(t *testing.T) {
+	tests := []struct {
+		name      string
+		prevIndex Index
+		prevTerm  Term
+		success   bool
+	}{
+		{name: "last compacted entry", prevIndex: 3, prevTerm: 1, success: true},
+		{name: "entry after the snapshot", prevIndex: 5, prevTerm: 2, success: true},
+		{name: "term conflict after the snapshot", prevIndex: 4, prevTerm: 1, success: false},
+		{name: "past the end", prevIndex: 6, prevTerm: 2, success: false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			follower := compacted(t)
+			reply := follower.AppendEntry(AppendEntries[string]{
+				Term:         2,
+				LeaderId:     2,
+				PrevLogIndex: test.prevIndex,
+				PrevLogTerm:  test.prevTerm,
+				Entries:      []LogEntry[string]{{Term: 2, Command: "SET"}},
+			})
+			if reply.Success != test.success {
+				t.Errorf("AppendEntry succeeded: %v, want %v", reply.Success, test.success)
+			}
+		})
+	}
+}
+
+func TestRestartResumesAfterSnapshot(t *testing.T) {
+	for name, open := range storageKinds() {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			first, err := NewInMemoryNetwork[string, int, bool]().Add(1, open(t, dir))
+			if err != nil {
+				t.Fatal(err)
+			}
+			start(t, first)
+			drain(first)
+			waitLeader(t, []*testModule{first})
+			propose := func(command string) Index {
+				ctx, cancel := context.WithTimeout(context.Background(), waitTimeout)
+				defer cancel()
+				index, _, err := first.ProposeWait(ctx, command)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return index
+			}
+			var snapshotIndex Index
+			for i := 0; i < 5; i++ {
+				snapshotIndex = propose(fmt.Sprintf("SET k %d", i))
+			}
+			if err := first.Snapshot(snapshotIndex, []byte("state")); err != nil {
+				t.Fatal(err)
+			}
+			last := propose("SET k after")
+			first.Close()
+
+			restored, err := NewInMemoryNetwork[string, int, bool]().Add(1, open(t, dir))
+			if err != nil {
+				t.Fatal(err)
+			}
+			restored.Mutex.Lock()
+			applied := restored.LastApplied
+			restored.Mutex.Unlock()
+			if applied != snapshotIndex {
+				t.Fatalf("restored with LastApplied %d, want the snapshot's %d", applied, snapshotIndex)
+			}
+			start(t, restored)
+			if msg := receive(t, restored); !msg.SnapshotValid || msg.Index != snapshotIndex {
+				t.Fatalf("first delivered %+v, want the snapshot through %d", msg, snapshotIndex)
+			}
+			// Only what came after the snapshot is applied again.
+			if msg := receive(t, restored); msg.Index != last || msg.Command != "SET k after" {
+				t.Errorf("then delivered %+v, want SET k after at %d", msg, last)
+			}
+		})
+	}
+}
+
+func TestSnapshotThresholdCompacts(t *testing.T) {
+	var applied atomic.Uint64
+	var calls atomic.Int32
+	snapshot := func() (Index, []byte, error) {
+		calls.Add(1)
+		return Index(applied.Load()), []byte("state"), nil
+	}
+	modules, _ := startCluster(t, 1, WithSnapshotThreshold(10, snapshot))
+	module := modules[0]
+	go func() {
+		for msg := range module.ReceiveChan {
+			applied.Store(uint64(msg.Index))
+		}
+	}()
+	waitLeader(t, modules)
+	ctx, cancel := context.WithTimeout(context.Background(), waitTimeout)
+	defer cancel()
+	for i := 0; i < 25; i++ {
+		if _, _, err := module.ProposeWait(ctx, fmt.Sprintf("SET k %d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	waitFor(t, "the log to be compacted", func() bool {
+		module.Mutex.Lock()
+		defer module.Mutex.Unlock()
+		return module.LastIncludedIndex >= 10
+	})
+	if calls.Load() == 0 {
+		t.Error("the snapshot callback was never asked for the state")
+	}
+	if _, err := module.Get(2); !errors.Is(err, ErrCompacted) {
+		t.Errorf("Get(2) after compaction = %v, want ErrCompacted", err)
+	}
+}
+
+func TestSnapshotKeepsConfiguration(t *testing.T) {
+	for name, open := range storageKinds() {
+		t.Run(name, func(t *testing.T) {
+			// Node 2 is on the network but was never made a member, so a
+			// node that forgot its configuration would count it as a peer.
+			reopen := func(dir string) *testModule {
+				network := NewInMemoryNetwork[string, int, bool]()
+				network.order = []uint{1, 2, 3}
+				module, err := network.Add(1, open(t, dir))
+				if err != nil {
+					t.Fatal(err)
+				}
+				t.Cleanup(module.Close)
+				return module
+			}
+			check := func(module *testModule, voters, peers []uint) {
+				t.Helper()
+				if got, _ := module.Configuration(); !slices.Equal(got, voters) {
+					t.Errorf("restored voters %v, want %v", got, voters)
+				}
+				if got := module.peerIds(); !slices.Equal(got, peers) {
+					t.Errorf("restored peers %v, want %v", got, peers)
+				}
+			}
+
+			dir := t.TempDir()
+			module := reopen(dir)
+			if err := module.Bootstrap([]uint{1}); err != nil {
+				t.Fatal(err)
+			}
+			start(t, module)
+			drain(module)
+			waitLeader(t, []*testModule{module})
+			ctx, cancel := context.WithTimeout(context.Background(), waitTimeout)
+			defer cancel()
+			index, _, err := module.ProposeWait(ctx, "SET a 1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			// The snapshot compacts the configuration entry at index 1.
+			if err := module.Snapshot(index, []byte("state")); err != nil {
+				t.Fatal(err)
+			}
+			module.Close()
+			check(reopen(dir), []uint{1}, []uint{})
+
+			// A snapshot installed from a leader is restored the same way.
+			dir = t.TempDir()
+			module = reopen(dir)
+			reply := module.InstallSnapshot(InstallSnapshot{Term: 1, LeaderId: 3, LastIncludedIndex: 5, LastIncludedTerm: 1, Configuration: []uint{1, 3}, Data: []byte("state")})
+			if !reply.Success {
+				t.Fatal("InstallSnapshot refused")
+			}
+			module.Close()
+			check(reopen(dir), []uint{1, 3}, []uint{3})
+		})
+	}
+}
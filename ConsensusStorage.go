@@ -0,0 +1,179 @@
+package raft
+
+import (
+	"maps"
+	"slices"
+	"sync"
+)
+
+// Storage keeps the state Raft requires to survive a restart: the current
+// term, the vote cast in it, the latest snapshot and the log after it. A
+// snapshot is always saved before the log it leaves behind, and SaveSnapshot
+// drops the entries it covers in the same write, so that a crash before the
+// next SaveLog never leaves a log that LoadLog returns out of place.
+type Storage[j any] interface {
+	SaveState(term Term, votedFor int) error
+	LoadState() (term Term, votedFor int, err error)
+	SaveLog(entries []LogEntry[j]) error
+	LoadLog() ([]LogEntry[j], error)
+	SaveSnapshot(lastIncludedIndex Index, lastIncludedTerm Term, data []byte) error
+	LoadSnapshot() (lastIncludedIndex Index, lastIncludedTerm Term, data []byte, err error)
+}
+
+// MemoryStorage is a Storage that only lives as long as the process, useful
+// for tests and examples.
+type MemoryStorage[j any] struct {
+	mutex    sync.Mutex
+	term     Term
+	votedFor int
+	log      []LogEntry[j]
+
+	lastIncludedIndex Index
+	lastIncludedTerm  Term
+	snapshot          []byte
+}
+
+func NewMemoryStorage[j any]() *MemoryStorage[j] {
+	return &MemoryStorage[j]{votedFor: -1}
+}
+
+func (m *MemoryStorage[j]) SaveState(term Term, votedFor int) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.term = term
+	m.votedFor = votedFor
+	return nil
+}
+
+func (m *MemoryStorage[j]) LoadState() (Term, int, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.term, m.votedFor, nil
+}
+
+func (m *MemoryStorage[j]) SaveLog(entries []LogEntry[j]) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.log = slices.Clone(entries)
+	return nil
+}
+
+func (m *MemoryStorage[j]) LoadLog() ([]LogEntry[j], error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return slices.Clone(m.log), nil
+}
+
+func (m *MemoryStorage[j]) SaveSnapshot(lastIncludedIndex Index, lastIncludedTerm Term, data []byte) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.log = trimLog(m.log, func(entry LogEntry[j]) Term { return entry.Term }, m.lastIncludedIndex, lastIncludedIndex, lastIncludedTerm)
+	m.lastIncludedIndex = lastIncludedIndex
+	m.lastIncludedTerm = lastIncludedTerm
+	m.snapshot = slices.Clone(data)
+	return nil
+}
+
+func (m *MemoryStorage[j]) LoadSnapshot() (Index, Term, []byte, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.lastIncludedIndex, m.lastIncludedTerm, slices.Clone(m.snapshot), nil
+}
+
+// trimLog returns what is left of log, which starts right after
+// previousIndex, once a snapshot through lastIncludedIndex is saved: the
+// entries after it when the entry at lastIncludedIndex has lastIncludedTerm,
+// and none when the snapshot has superseded the log.
+func trimLog[E any](log []E, term func(E) Term, previousIndex, lastIncludedIndex Index, lastIncludedTerm Term) []E {
+	if lastIncludedIndex == previousIndex {
+		return log
+	}
+	if lastIncludedIndex > previousIndex {
+		position := int(lastIncludedIndex - previousIndex - 1)
+		if position < len(log) && term(log[position]) == lastIncludedTerm {
+			return slices.Clone(log[position+1:])
+		}
+	}
+	return nil
+}
+
+// persistState saves CurrentTerm and VotedFor. It expects c.Mutex to be held.
+func (c *ConsensusModule[j, x, k]) persistState() error {
+	if err := c.Storage.SaveState(c.CurrentTerm, c.VotedFor); err != nil {
+		c.warn("failed to save state", "err", err)
+		return err
+	}
+	return nil
+}
+
+// persistLog saves the log, remembering in logUnsaved whether Storage is
+// now behind it. It expects c.Mutex to be held.
+func (c *ConsensusModule[j, x, k]) persistLog() error {
+	err := c.Storage.SaveLog(c.Log)
+	c.logUnsaved = err != nil
+	if err != nil {
+		c.warn("failed to save log", "err", err)
+		return err
+	}
+	return nil
+}
+
+// persistSnapshot saves the snapshot covering the log up to
+// lastIncludedIndex, together with the client sessions and configuration as
+// of then. It expects c.Mutex to be held.
+func (c *ConsensusModule[j, x, k]) persistSnapshot(lastIncludedIndex Index, lastIncludedTerm Term, state snapshotState) error {
+	encoded, err := encodeSnapshot(state)
+	if err != nil {
+		return err
+	}
+	if err := c.Storage.SaveSnapshot(lastIncludedIndex, lastIncludedTerm, encoded); err != nil {
+		c.warn("failed to save snapshot", "err", err)
+		return err
+	}
+	return nil
+}
+
+// restore loads the persisted term, vote, snapshot and log, falling back to
+// defaultLog for a node that has saved neither a snapshot nor a log. A
+// restored snapshot counts as committed and applied, its configuration as the
+// committed one, and the log is taken to start right after it.
+func (c *ConsensusModule[j, x, k]) restore(defaultLog []LogEntry[j]) error {
+	term, votedFor, err := c.Storage.LoadState()
+	if err != nil {
+		return err
+	}
+	lastIncludedIndex, lastIncludedTerm, encoded, err := c.Storage.LoadSnapshot()
+	if err != nil {
+		return err
+	}
+	log, err := c.Storage.LoadLog()
+	if err != nil {
+		return err
+	}
+	c.CurrentTerm = term
+	c.VotedFor = votedFor
+	if lastIncludedIndex > 0 {
+		state, err := decodeSnapshot(encoded)
+		if err != nil {
+			return err
+		}
+		c.snapshotSessions = state.Sessions
+		c.sessions = maps.Clone(state.Sessions)
+		c.snapshotConfiguration, c.snapshotLearners = state.Configuration, state.Learners
+		c.configuration = slices.Clone(state.Configuration)
+		c.learners = slices.Clone(state.Learners)
+		c.LastIncludedIndex = lastIncludedIndex
+		c.LastIncludedTerm = lastIncludedTerm
+		c.snapshot = state.Data
+		c.CommitIndex = max(c.CommitIndex, lastIncludedIndex)
+		c.LastApplied = max(c.LastApplied, lastIncludedIndex)
+		c.Log = log
+		return nil
+	}
+	if len(log) == 0 {
+		c.Log = defaultLog
+		return c.Storage.SaveLog(c.Log)
+	}
+	c.Log = log
+	return nil
+}
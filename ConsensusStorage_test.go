@@ -0,0 +1,159 @@
+package raft
+
+import (
+	"context"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// storageKinds opens each Storage implementation in dir. Opening the same dir
+// twice stands in for a restart; MemoryStorage survives it by being reused.
+func storageKinds() map[string]func(t *testing.T, dir string) Storage[string] {
+	memory := map[string]*MemoryStorage[string]{}
+	return map[string]func(t *testing.T, dir string) Storage[string]{
+		"memory": func(t *testing.T, dir string) Storage[string] {
+			if memory[dir] == nil {
+				memory[dir] = NewMemoryStorage[string]()
+			}
+			return memory[dir]
+		},
+		"file": func(t *testing.T, dir string) Storage[string] {
+			storage, err := NewFileStorage[string](filepath.Join(dir, "state.json"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			return storage
+		},
+		"wal": func(t *testing.T, dir string) Storage[string] {
+			storage, err := NewWALStorage[string](dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { storage.Close() })
+			return storage
+		},
+	}
+}
+
+func TestSaveSnapshotTrimsLog(t *testing.T) {
+	log := []LogEntry[string]{
+		{Term: 1, Command: "a"},
+		{Term: 1, Command: "b"},
+		{Term: 2, Command: "c"},
+		{Term: 2, Command: "d"},
+		{Term: 2, Command: "e"},
+	}
+	for name, open := range storageKinds() {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			storage := open(t, dir)
+			if err := storage.SaveLog(log); err != nil {
+				t.Fatal(err)
+			}
+			// The node crashes after saving the snapshot and before saving
+			// the log it leaves behind.
+			data, err := encodeSnapshot(snapshotState{Data: []byte("state")})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := storage.SaveSnapshot(3, 2, data); err != nil {
+				t.Fatal(err)
+			}
+			if w, ok := storage.(*WALStorage[string]); ok {
+				w.Close()
+			}
+
+			module, err := NewInMemoryNetwork[string, int, bool]().Add(1, open(t, dir))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if index := module.LastLogIndex(); index != 5 {
+				t.Errorf("LastLogIndex = %d, want 5", index)
+			}
+			if term := module.termAt(4); term != 2 {
+				t.Errorf("termAt(4) = %d, want 2", term)
+			}
+			if entry, err := module.Get(5); err != nil || entry.Command != "e" {
+				t.Errorf("Get(5) = %v, %v, want e", entry, err)
+			}
+		})
+	}
+}
+
+func TestSaveSnapshotDropsConflictingLog(t *testing.T) {
+	for name, open := range storageKinds() {
+		t.Run(name, func(t *testing.T) {
+			storage := open(t, t.TempDir())
+			if err := storage.SaveLog([]LogEntry[string]{{Term: 1}, {Term: 1}}); err != nil {
+				t.Fatal(err)
+			}
+			if err := storage.SaveSnapshot(2, 3, nil); err != nil {
+				t.Fatal(err)
+			}
+			log, err := storage.LoadLog()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(log) != 0 {
+				t.Errorf("LoadLog = %v, want the log the snapshot superseded dropped", log)
+			}
+		})
+	}
+}
+
+// checkRestores runs a single node on storage from open until it has
+// committed a few commands, then builds a second node on storage from open
+// again and checks that it comes back with the same term, vote and log.
+func checkRestores(t *testing.T, open func() Storage[string]) {
+	t.Helper()
+	first, err := NewInMemoryNetwork[string, int, bool]().Add(1, open())
+	if err != nil {
+		t.Fatal(err)
+	}
+	start(t, first)
+	waitLeader(t, []*testModule{first})
+	for _, command := range []string{"SET a 1", "SET b 2"} {
+		ctx, cancel := context.WithTimeout(context.Background(), waitTimeout)
+		_, _, err := first.ProposeWait(ctx, command)
+		cancel()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	first.Close()
+
+	restored, err := NewInMemoryNetwork[string, int, bool]().Add(1, open())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(restored.Close)
+	first.Mutex.Lock()
+	defer first.Mutex.Unlock()
+	restored.Mutex.Lock()
+	defer restored.Mutex.Unlock()
+	if restored.CurrentTerm != first.CurrentTerm || restored.VotedFor != first.VotedFor {
+		t.Errorf("restored term %d and vote %d, want %d and %d", restored.CurrentTerm, restored.VotedFor, first.CurrentTerm, first.VotedFor)
+	}
+	if !slices.EqualFunc(restored.Log, first.Log, func(a, b LogEntry[string]) bool {
+		return a.Term == b.Term && a.Type == b.Type && a.Command == b.Command
+	}) {
+		t.Errorf("restored log %v, want %v", restored.Log, first.Log)
+	}
+}
+
+func TestRestoreFromMemoryStorage(t *testing.T) {
+	storage := NewMemoryStorage[string]()
+	checkRestores(t, func() Storage[string] { return storage })
+}
+
+func TestRestoreFromFileStorage(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	checkRestores(t, func() Storage[string] {
+		storage, err := NewFileStorage[string](path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return storage
+	})
+}
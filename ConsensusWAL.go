@@ -0,0 +1,547 @@
+package raft
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultWALSegmentSize = 4 << 20
+
+	walStateFile    = "state.json"
+	walSnapshotFile = "snapshot.json"
+	walSuffix       = ".wal"
+
+	// walHeaderSize is the length and CRC-32 that precede every record.
+	walHeaderSize = 8
+)
+
+// WALStorage is a Storage that keeps the log in a write-ahead log of segment
+// files in a directory, so that a save appends only the entries that changed
+// instead of rewriting the whole log. Term and vote, and the snapshot, live
+// in files of their own that are replaced atomically like FileStorage's.
+//
+// Each save appends a record per new entry; an entry replaces the one held at
+// its index along with everything after it, and a truncation record drops a
+// suffix that nothing replaces. Segments are rolled over once they reach the
+// segment size, and those wholly covered by a snapshot are deleted. Opening
+// the directory replays the segments in order, cutting off a record torn by
+// a crash at the end of the last one.
+//
+// Every save is synced before it returns unless WithWALSyncInterval is given,
+// in which case the log is synced at most once per interval by a background
+// goroutine and Close. That spares high-rate proposals an fsync apiece, at
+// the price of losing the saves of the last interval if the machine, rather
+// than just the process, goes down. Raft counts on those saves, so only use
+// it where that risk is acceptable. Commands are encoded with the module's
+// Codec.
+type WALStorage[j any] struct {
+	mutex  sync.Mutex
+	dir    string
+	config walConfig
+	codec  Codec[j]
+
+	term              Term
+	votedFor          int
+	lastIncludedIndex Index
+	lastIncludedTerm  Term
+	snapshot          []byte
+	// entries after lastIncludedIndex, as replayed or last saved
+	log []encodedEntry
+
+	segments   []walSegment
+	active     *os.File
+	activeSize int64
+	dirty      bool
+	closed     bool
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+type walConfig struct {
+	segmentSize  int64
+	syncInterval time.Duration
+}
+
+// WALOption adjusts a WALStorage under construction.
+type WALOption func(*walConfig)
+
+// WithWALSegmentSize sets the size in bytes a segment grows to before a new
+// one is started.
+func WithWALSegmentSize(size int64) WALOption {
+	return func(config *walConfig) {
+		config.segmentSize = size
+	}
+}
+
+// WithWALSyncInterval syncs the log at most once per interval instead of on
+// every save.
+func WithWALSyncInterval(interval time.Duration) WALOption {
+	return func(config *walConfig) {
+		config.syncInterval = interval
+	}
+}
+
+// walSegment is a segment file and the highest index any of its records
+// touches.
+type walSegment struct {
+	seq       uint64
+	lastIndex Index
+}
+
+// walRecord either writes Entry at Index or, with no Entry, drops the entries
+// from Index on.
+type walRecord struct {
+	Index Index
+	Entry *encodedEntry `json:",omitempty"`
+}
+
+type walState struct {
+	Term     Term
+	VotedFor int
+}
+
+type walSnapshot struct {
+	LastIncludedIndex Index
+	LastIncludedTerm  Term
+	Data              []byte
+}
+
+// NewWALStorage opens the write-ahead log in dir, creating the directory if
+// needed and replaying whatever it already holds.
+func NewWALStorage[j any](dir string, options ...WALOption) (*WALStorage[j], error) {
+	config := walConfig{segmentSize: defaultWALSegmentSize}
+	for _, option := range options {
+		option(&config)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	w := &WALStorage[j]{
+		dir:      dir,
+		config:   config,
+		codec:    JSONCodec[j]{},
+		votedFor: -1,
+	}
+	if err := w.recover(); err != nil {
+		return nil, err
+	}
+	if config.syncInterval > 0 {
+		w.stop = make(chan struct{})
+		w.done = make(chan struct{})
+		go w.syncLoop()
+	}
+	return w, nil
+}
+
+// UseCodec sets the codec commands are encoded with. Entries already in the
+// log are decoded with it too, so it has to match the one they were saved
+// with.
+func (w *WALStorage[j]) UseCodec(codec Codec[j]) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.codec = codec
+}
+
+func (w *WALStorage[j]) SaveState(term Term, votedFor int) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	data, err := json.Marshal(walState{Term: term, VotedFor: votedFor})
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(filepath.Join(w.dir, walStateFile), data); err != nil {
+		return err
+	}
+	w.term = term
+	w.votedFor = votedFor
+	return nil
+}
+
+func (w *WALStorage[j]) LoadState() (Term, int, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.term, w.votedFor, nil
+}
+
+// SaveLog appends records for the entries that differ from the last saved
+// log. Entries at the same index and term are the same entry, so only terms
+// need comparing.
+func (w *WALStorage[j]) SaveLog(entries []LogEntry[j]) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.closed {
+		return ErrClosed
+	}
+	same := 0
+	for same < len(entries) && same < len(w.log) && entries[same].Term == w.log[same].Term && entries[same].Type == w.log[same].Type {
+		same++
+	}
+	var records []walRecord
+	if same == len(entries) && same < len(w.log) {
+		records = append(records, walRecord{Index: w.lastIncludedIndex + Index(same) + 1})
+	}
+	added := make([]encodedEntry, 0, len(entries)-same)
+	for position := same; position < len(entries); position++ {
+		encoded, err := encodeEntry(w.codec, entries[position])
+		if err != nil {
+			return err
+		}
+		added = append(added, encoded)
+		records = append(records, walRecord{
+			Index: w.lastIncludedIndex + Index(position) + 1,
+			Entry: &added[len(added)-1],
+		})
+	}
+	if len(records) == 0 {
+		return nil
+	}
+	if err := w.append(records); err != nil {
+		return err
+	}
+	w.log = append(w.log[:same:same], added...)
+	return nil
+}
+
+func (w *WALStorage[j]) LoadLog() ([]LogEntry[j], error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return decodeEntries(w.codec, w.log)
+}
+
+// SaveSnapshot replaces the snapshot file and then drops the entries it
+// covers, keeping those after it only when the entry at lastIncludedIndex
+// agrees with it. Segments holding nothing past the snapshot are deleted.
+func (w *WALStorage[j]) SaveSnapshot(lastIncludedIndex Index, lastIncludedTerm Term, data []byte) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.closed {
+		return ErrClosed
+	}
+	encoded, err := json.Marshal(walSnapshot{
+		LastIncludedIndex: lastIncludedIndex,
+		LastIncludedTerm:  lastIncludedTerm,
+		Data:              data,
+	})
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(filepath.Join(w.dir, walSnapshotFile), encoded); err != nil {
+		return err
+	}
+	keep := lastIncludedIndex == w.lastIncludedIndex
+	if lastIncludedIndex > w.lastIncludedIndex {
+		position := int(lastIncludedIndex - w.lastIncludedIndex - 1)
+		keep = position < len(w.log) && w.log[position].Term == lastIncludedTerm
+		if keep {
+			w.log = slices.Clone(w.log[position+1:])
+		}
+	}
+	w.lastIncludedIndex = lastIncludedIndex
+	w.lastIncludedTerm = lastIncludedTerm
+	w.snapshot = slices.Clone(data)
+	if !keep {
+		w.log = nil
+		if err := w.append([]walRecord{{Index: lastIncludedIndex + 1}}); err != nil {
+			return err
+		}
+	}
+	return w.compact()
+}
+
+func (w *WALStorage[j]) LoadSnapshot() (Index, Term, []byte, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.lastIncludedIndex, w.lastIncludedTerm, slices.Clone(w.snapshot), nil
+}
+
+// Close syncs and closes the log. Saves after Close fail with ErrClosed.
+func (w *WALStorage[j]) Close() error {
+	w.mutex.Lock()
+	if w.closed {
+		w.mutex.Unlock()
+		return nil
+	}
+	w.closed = true
+	w.mutex.Unlock()
+	if w.stop != nil {
+		close(w.stop)
+		<-w.done
+	}
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	err := w.active.Sync()
+	if closeErr := w.active.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// append writes records to the active segment, syncing them unless a sync
+// interval is set, and rolls over to a new segment once the active one is
+// full. It expects w.mutex to be held.
+func (w *WALStorage[j]) append(records []walRecord) error {
+	var buffer []byte
+	segment := &w.segments[len(w.segments)-1]
+	for _, record := range records {
+		payload, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		buffer = binary.LittleEndian.AppendUint32(buffer, uint32(len(payload)))
+		buffer = binary.LittleEndian.AppendUint32(buffer, crc32.ChecksumIEEE(payload))
+		buffer = append(buffer, payload...)
+		segment.lastIndex = max(segment.lastIndex, record.Index)
+	}
+	if _, err := w.active.Write(buffer); err != nil {
+		return err
+	}
+	w.activeSize += int64(len(buffer))
+	if w.config.syncInterval > 0 {
+		w.dirty = true
+	} else if err := w.active.Sync(); err != nil {
+		return err
+	}
+	if w.activeSize >= w.config.segmentSize {
+		return w.rollover()
+	}
+	return nil
+}
+
+// rollover syncs and closes the active segment and starts the next one. It
+// expects w.mutex to be held.
+func (w *WALStorage[j]) rollover() error {
+	if err := w.active.Sync(); err != nil {
+		return err
+	}
+	w.dirty = false
+	if err := w.active.Close(); err != nil {
+		return err
+	}
+	return w.openSegment(w.segments[len(w.segments)-1].seq + 1)
+}
+
+// openSegment creates the segment seq and makes it the active one. It
+// expects w.mutex to be held.
+func (w *WALStorage[j]) openSegment(seq uint64) error {
+	file, err := os.OpenFile(w.segmentPath(seq), os.O_CREATE|os.O_EXCL|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	syncDir(w.dir)
+	w.segments = append(w.segments, walSegment{seq: seq})
+	w.active = file
+	w.activeSize = 0
+	return nil
+}
+
+// compact deletes the oldest segments as long as everything they hold is
+// covered by the snapshot, never touching the active one. It expects w.mutex
+// to be held.
+func (w *WALStorage[j]) compact() error {
+	removed := 0
+	for _, segment := range w.segments[:len(w.segments)-1] {
+		if segment.lastIndex > w.lastIncludedIndex {
+			break
+		}
+		if err := os.Remove(w.segmentPath(segment.seq)); err != nil {
+			return err
+		}
+		removed++
+	}
+	if removed > 0 {
+		w.segments = slices.Delete(w.segments, 0, removed)
+		syncDir(w.dir)
+	}
+	return nil
+}
+
+// syncLoop syncs the active segment once per sync interval while there are
+// unsynced writes, until Close.
+func (w *WALStorage[j]) syncLoop() {
+	defer close(w.done)
+	ticker := time.NewTicker(w.config.syncInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+		}
+		w.mutex.Lock()
+		if w.dirty {
+			w.dirty = w.active.Sync() != nil
+		}
+		w.mutex.Unlock()
+	}
+}
+
+func (w *WALStorage[j]) segmentPath(seq uint64) string {
+	return filepath.Join(w.dir, fmt.Sprintf("%020d%s", seq, walSuffix))
+}
+
+// recover loads the state and snapshot files and replays the segments on
+// top of the snapshot, then reopens the last segment for appending. It
+// expects to be called before w is shared.
+func (w *WALStorage[j]) recover() error {
+	var state walState
+	if found, err := readJSON(filepath.Join(w.dir, walStateFile), &state); err != nil {
+		return err
+	} else if found {
+		w.term = state.Term
+		w.votedFor = state.VotedFor
+	}
+	var snapshot walSnapshot
+	if _, err := readJSON(filepath.Join(w.dir, walSnapshotFile), &snapshot); err != nil {
+		return err
+	}
+	w.lastIncludedIndex = snapshot.LastIncludedIndex
+	w.lastIncludedTerm = snapshot.LastIncludedTerm
+	w.snapshot = snapshot.Data
+
+	seqs, err := w.listSegments()
+	if err != nil {
+		return err
+	}
+	if len(seqs) == 0 {
+		return w.openSegment(1)
+	}
+	for i, seq := range seqs {
+		last := i == len(seqs)-1
+		segment, size, err := w.replay(seq, last)
+		if err != nil {
+			return err
+		}
+		w.segments = append(w.segments, segment)
+		if last {
+			file, err := os.OpenFile(w.segmentPath(seq), os.O_WRONLY|os.O_APPEND, 0o644)
+			if err != nil {
+				return err
+			}
+			w.active = file
+			w.activeSize = size
+		}
+	}
+	return nil
+}
+
+// replay applies the records of segment seq to w.log and returns the
+// segment with its size. A torn record at the end of the last segment is cut
+// off; anywhere else it makes the log corrupt. It expects to be called
+// before w is shared.
+func (w *WALStorage[j]) replay(seq uint64, last bool) (walSegment, int64, error) {
+	segment := walSegment{seq: seq}
+	path := w.segmentPath(seq)
+	file, err := os.Open(path)
+	if err != nil {
+		return segment, 0, err
+	}
+	defer file.Close()
+	reader := bufio.NewReader(file)
+	var offset int64
+	header := make([]byte, walHeaderSize)
+	for {
+		if _, err := io.ReadFull(reader, header); err == io.EOF {
+			return segment, offset, nil
+		} else if err != nil {
+			return w.torn(segment, path, offset, last)
+		}
+		payload := make([]byte, binary.LittleEndian.Uint32(header))
+		if _, err := io.ReadFull(reader, payload); err != nil {
+			return w.torn(segment, path, offset, last)
+		}
+		if crc32.ChecksumIEEE(payload) != binary.LittleEndian.Uint32(header[4:]) {
+			return w.torn(segment, path, offset, last)
+		}
+		var record walRecord
+		if err := json.Unmarshal(payload, &record); err != nil {
+			return segment, 0, err
+		}
+		if err := w.apply(record); err != nil {
+			return segment, 0, fmt.Errorf("%w: segment %d: %v", ErrWALCorrupt, seq, err)
+		}
+		segment.lastIndex = max(segment.lastIndex, record.Index)
+		offset += int64(walHeaderSize + len(payload))
+	}
+}
+
+// torn handles a record that could not be read whole at offset in segment
+// path. It expects to be called before w is shared.
+func (w *WALStorage[j]) torn(segment walSegment, path string, offset int64, last bool) (walSegment, int64, error) {
+	if !last {
+		return segment, 0, fmt.Errorf("%w: segment %d is cut short", ErrWALCorrupt, segment.seq)
+	}
+	if err := os.Truncate(path, offset); err != nil {
+		return segment, 0, err
+	}
+	return segment, offset, nil
+}
+
+// apply replays a single record onto w.log. Records the snapshot covers are
+// skipped. It expects to be called before w is shared.
+func (w *WALStorage[j]) apply(record walRecord) error {
+	if record.Index <= w.lastIncludedIndex {
+		return nil
+	}
+	position := int(record.Index - w.lastIncludedIndex - 1)
+	if record.Entry == nil {
+		if position < len(w.log) {
+			w.log = w.log[:position]
+		}
+		return nil
+	}
+	if position > len(w.log) {
+		return fmt.Errorf("entry %d follows a gap", record.Index)
+	}
+	w.log = append(w.log[:position], *record.Entry)
+	return nil
+}
+
+// listSegments returns the sequence numbers of the segments in w.dir in
+// order.
+func (w *WALStorage[j]) listSegments() ([]uint64, error) {
+	files, err := os.ReadDir(w.dir)
+	if err != nil {
+		return nil, err
+	}
+	var seqs []uint64
+	for _, file := range files {
+		name, ok := strings.CutSuffix(file.Name(), walSuffix)
+		if !ok || file.IsDir() {
+			continue
+		}
+		seq, err := strconv.ParseUint(name, 10, 64)
+		if err != nil {
+			continue
+		}
+		seqs = append(seqs, seq)
+	}
+	slices.Sort(seqs)
+	return seqs, nil
+}
+
+// readJSON decodes the file at path into value, reporting false if there is
+// no such file.
+func readJSON(path string, value any) (bool, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return true, json.Unmarshal(data, value)
+}
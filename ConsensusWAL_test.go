@@ -0,0 +1,116 @@
+package raft
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// walEntries returns n entries in term, numbered from first.
+func walEntries(term Term, first, n int) []LogEntry[string] {
+	var entries []LogEntry[string]
+	for i := first; i < first+n; i++ {
+		entries = append(entries, LogEntry[string]{Term: term, Command: fmt.Sprintf("SET %d", i)})
+	}
+	return entries
+}
+
+func TestWALRecoversAfterCrash(t *testing.T) {
+	dir := t.TempDir()
+	open := func() *WALStorage[string] {
+		t.Helper()
+		storage, err := NewWALStorage[string](dir, WithWALSegmentSize(256))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { storage.Close() })
+		return storage
+	}
+	storage := open()
+	log := walEntries(1, 1, 20)
+	// A new leader overwrites the tail, and then a shorter log drops more of
+	// it than it replaces.
+	conflicting := append(log[:15:15], walEntries(2, 16, 3)...)
+	for _, save := range [][]LogEntry[string]{log, conflicting, conflicting[:12]} {
+		if err := storage.SaveLog(save); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := storage.SaveSnapshot(5, 1, []byte("state")); err != nil {
+		t.Fatal(err)
+	}
+
+	// The process dies without closing, halfway through writing a record.
+	seqs, err := storage.listSegments()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(seqs) < 2 {
+		t.Fatalf("log fits in %d segment, want a test across several", len(seqs))
+	}
+	file, err := os.OpenFile(storage.segmentPath(seqs[len(seqs)-1]), os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := file.Write([]byte{100, 0, 0, 0, 1, 2, 3, 4, '{'}); err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+
+	check := func(storage *WALStorage[string], want []LogEntry[string]) {
+		t.Helper()
+		got, err := storage.LoadLog()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("recovered log %v, want %v", got, want)
+		}
+		index, term, data, err := storage.LoadSnapshot()
+		if err != nil || index != 5 || term != 1 || string(data) != "state" {
+			t.Errorf("recovered snapshot %d, %d, %q, %v; want 5, 1, \"state\"", index, term, data, err)
+		}
+	}
+	recovered := open()
+	want := conflicting[5:12]
+	check(recovered, want)
+
+	// The torn record is gone, so what is saved next survives another
+	// restart.
+	want = append(want, walEntries(3, 13, 1)...)
+	if err := recovered.SaveLog(want); err != nil {
+		t.Fatal(err)
+	}
+	recovered.Close()
+	check(open(), want)
+}
+
+func BenchmarkWALSaveLog(b *testing.B) {
+	for name, options := range map[string][]WALOption{
+		"per-entry sync": nil,
+		"batched sync":   {WithWALSyncInterval(5 * time.Millisecond)},
+	} {
+		b.Run(name, func(b *testing.B) {
+			storage, err := NewWALStorage[string](b.TempDir(), options...)
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer storage.Close()
+			var log []LogEntry[string]
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				// Start over now and then so that comparing with the saved log
+				// does not come to dominate.
+				if len(log) == 1000 {
+					log = log[:0]
+				}
+				log = append(log, LogEntry[string]{Term: 1, Command: "SET a 1"})
+				if err := storage.SaveLog(log); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -1,103 +1,146 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"slices"
 	"strconv"
 	"strings"
-	"sync"
 	"time"
 
 	raft "raft-go"
 )
 
 func main() {
-	cx := new(ContactExample[string, int, bool])
-	s1 := raft.NewConsensusModule[string, int, bool](cx)
-	s2 := raft.NewConsensusModule[string, int, bool](cx)
-	s3 := raft.NewConsensusModule[string, int, bool](cx)
-	cx.AddPeer(s1)
-	cx.AddPeer(s2)
-	cx.AddPeer(s3)
-	var wg sync.WaitGroup
-	wg.Add(3)
-	go s1.RunServer(cx.Done)
-	go s2.RunServer(cx.Done)
-	go s3.RunServer(cx.Done)
-	time.Sleep(time.Second * 1)
-	cx.Leader = cx.GetLeader()
-	fmt.Println(cx.Leader)
-	elcx := cx.GetExactLeader()
-	entry := raft.AppendEntries[string]{
-		Term:         elcx.CurrentTerm,
-		LeaderId:     cx.Leader,
-		PrevLogTerm:  elcx.Log[len(elcx.Log)-1].Command,
-		PrevLogIndex: len(elcx.Log),
-		Entries:      []raft.LogEntry[string]{{Term: elcx.CurrentTerm, Command: "SET 50"}},
+	if err := run(); err != nil {
+		log.Fatal(err)
 	}
-	elcx.AppendEntry(entry)
-	for _, peer := range cx.Peers {
-		peer.AppendEntry(entry)
+}
+
+// run starts a three node cluster, waits for a leader, commits one command
+// through it and shuts the cluster down. It gives up after ten seconds or on
+// an interrupt.
+func run() error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	cx := &ContactExample[string, int, bool]{Ids: []uint{1, 2, 3}}
+	for _, id := range cx.Ids {
+		module, err := raft.NewConsensusModule[string, int, bool](id, cx.ForNode(id), raft.NewMemoryStorage[string]())
+		if err != nil {
+			return err
+		}
+		defer module.Close()
+		cx.AddPeer(module)
 	}
-	wg.Wait()
+	elected := make(chan *raft.ConsensusModule[string, int, bool], len(cx.Peers))
+	for _, module := range cx.Peers {
+		changes := module.LeaderChanges()
+		go func(module *raft.ConsensusModule[string, int, bool]) {
+			for leader := range changes {
+				if leader {
+					select {
+					case elected <- module:
+					default:
+					}
+				}
+			}
+		}(module)
+		go func(module *raft.ConsensusModule[string, int, bool]) {
+			for range module.ReceiveChan {
+			}
+		}(module)
+		module.Start(ctx)
+	}
+
+	var leader *raft.ConsensusModule[string, int, bool]
+	select {
+	case leader = <-elected:
+	case <-ctx.Done():
+		return fmt.Errorf("no leader elected: %w", ctx.Err())
+	}
+	cx.Leader = leader.Id
+	fmt.Println("Leader is node", cx.Leader)
+	index, term, err := leader.ProposeWait(ctx, "SET 50")
+	if err != nil {
+		return err
+	}
+	fmt.Println("Committed index", index, "in term", term)
+	return nil
 }
 
 type ContactExample[j string, x int, k bool] struct {
 	Leader uint
+	Ids    []uint
 	Peers  []*raft.ConsensusModule[j, x, k]
-	Done   <-chan k
+}
+
+// NodeContact is the view of the cluster handed to a single module, so that
+// peer lists and RPC fan-out leave out the module itself.
+type NodeContact[j string, x int, k bool] struct {
+	*ContactExample[j, x, k]
+	Self uint
+}
+
+// ForNode returns a Contact for the module with the given id.
+func (c *ContactExample[j, x, k]) ForNode(id uint) *NodeContact[j, x, k] {
+	return &NodeContact[j, x, k]{ContactExample: c, Self: id}
 }
 
 func (c *ContactExample[j, x, k]) AddPeer(module *raft.ConsensusModule[j, x, k]) {
 	c.Peers = append(c.Peers, module)
 }
 
-func (c *ContactExample[j, x, k]) GetPeerIds() []uint {
+func (c *NodeContact[j, x, k]) GetPeerIds() []uint {
 	var final []uint
-	var mu sync.Mutex
-	var wg sync.WaitGroup
-	for _, peer := range c.Peers {
-		wg.Add(1)
-		peer := peer
-		go func(cm *raft.ConsensusModule[j, x, k]) {
-			cm.Mutex.Lock()
-			mu.Lock()
-			defer mu.Unlock()
-			defer wg.Done()
-			defer cm.Mutex.Unlock()
-			final = append(final, peer.Id)
-		}(peer)
+	for _, id := range c.Ids {
+		if id != c.Self {
+			final = append(final, id)
+		}
 	}
-	wg.Wait()
 	return final
 }
 
-func (c *ContactExample[j, x, k]) RequestVotes(vote raft.RequestVote[j]) []raft.Reply {
-	var replies []raft.Reply
+func (c *NodeContact[j, x, k]) RequestVotes(ctx context.Context, vote raft.RequestVote[j]) map[uint]raft.Reply {
+	replies := make(map[uint]raft.Reply)
 	for _, peer := range c.Peers {
-		peer := peer
-		voteResponse := peer.Vote(vote)
-		replies = append(replies, voteResponse)
+		if peer.Id == c.Self || ctx.Err() != nil {
+			continue
+		}
+		replies[peer.Id] = peer.Vote(vote)
 	}
 	return replies
 }
 
-func (c *ContactExample[j, x, k]) AppendEntries(entries raft.AppendEntries[j]) []raft.Reply {
-	var replies []raft.Reply
-	cl := c.GetExactLeader().Log
-	cl = append(cl, entries.Entries...)
+func (c *NodeContact[j, x, k]) AppendEntries(ctx context.Context, entries map[uint]raft.AppendEntries[j]) map[uint]raft.Reply {
+	replies := make(map[uint]raft.Reply)
 	for _, peer := range c.Peers {
-		if peer.State == raft.Leader {
+		request, ok := entries[peer.Id]
+		if peer.Id == c.Self || !ok || ctx.Err() != nil {
 			continue
 		}
-		appendResponse := peer.AppendEntry(entries)
-		replies = append(replies, appendResponse)
+		replies[peer.Id] = peer.AppendEntry(request)
 	}
 	return replies
 }
 
+func (c *NodeContact[j, x, k]) InstallSnapshot(_ context.Context, id uint, snapshot raft.InstallSnapshot) raft.Reply {
+	for _, peer := range c.Peers {
+		if peer.Id == id {
+			return peer.InstallSnapshot(snapshot)
+		}
+	}
+	return raft.Reply{}
+}
+
 func (c *ContactExample[j, x, k]) GetLeader() uint {
 	for _, peer := range c.Peers {
-		if peer.State == raft.Leader {
+		if _, isLeader, _ := peer.GetState(); isLeader {
 			return peer.Id
 		}
 	}
@@ -106,7 +149,7 @@ func (c *ContactExample[j, x, k]) GetLeader() uint {
 
 func (c *ContactExample[j, x, k]) GetExactLeader() *raft.ConsensusModule[j, x, k] {
 	for _, peer := range c.Peers {
-		if peer.State == raft.Leader {
+		if _, isLeader, _ := peer.GetState(); isLeader {
 			return peer
 		}
 	}
@@ -136,14 +179,22 @@ func (c *ContactExample[j, x, k]) DefaultLogEntryCommand() j {
 	return "NEXT"
 }
 
+// GetLeaderLog returns a copy of the leader's log, taken under its lock, or
+// nil while there is no leader.
 func (c *ContactExample[j, x, k]) GetLeaderLog() []raft.LogEntry[j] {
-	return c.GetExactLeader().Log
+	leader := c.GetExactLeader()
+	if leader == nil {
+		return nil
+	}
+	leader.Mutex.Lock()
+	defer leader.Mutex.Unlock()
+	return slices.Clone(leader.Log)
 }
 
 func (c *ContactExample[j, x, k]) ValidLog(log []raft.LogEntry[j]) bool {
 	final := true
 	for _, item := range log {
-		if !c.ValidLogEntryCommand(item.Command) {
+		if item.Type == raft.CommandEntry && !c.ValidLogEntryCommand(item.Command) {
 			final = false
 			break
 		}
@@ -154,6 +205,9 @@ func (c *ContactExample[j, x, k]) ValidLog(log []raft.LogEntry[j]) bool {
 func (c *ContactExample[j, x, k]) LogValue(log []raft.LogEntry[j]) x {
 	total := 0
 	for _, item := range log {
+		if item.Type != raft.CommandEntry {
+			continue
+		}
 		if strings.HasPrefix(string(item.Command), "SET ") {
 			values := strings.SplitN(string(item.Command), " ", 2)
 			value, err := strconv.Atoi(values[1])
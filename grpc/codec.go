@@ -0,0 +1,39 @@
+package grpc
+
+import (
+	"fmt"
+
+	"google.golang.org/grpc/encoding"
+)
+
+// codecName is the content-subtype RPCs are sent with. The payloads are the
+// protobuf encoding of the messages in raft.proto, but they are produced by
+// hand, so the codec is registered under its own name rather than replacing
+// the global "proto" codec.
+const codecName = "raftproto"
+
+func init() {
+	encoding.RegisterCodec(codec{})
+}
+
+type codec struct{}
+
+func (codec) Marshal(v any) ([]byte, error) {
+	m, ok := v.(message)
+	if !ok {
+		return nil, fmt.Errorf("raft grpc: cannot marshal %T", v)
+	}
+	return m.marshal()
+}
+
+func (codec) Unmarshal(data []byte, v any) error {
+	m, ok := v.(message)
+	if !ok {
+		return fmt.Errorf("raft grpc: cannot unmarshal into %T", v)
+	}
+	return m.unmarshal(data)
+}
+
+func (codec) Name() string {
+	return codecName
+}
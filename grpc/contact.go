@@ -0,0 +1,180 @@
+package grpc
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	gogrpc "google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+
+	raft "raft-go"
+)
+
+const (
+	defaultTimeout = 100 * time.Millisecond
+	defaultRetries = 2
+)
+
+// Contact is a raft.Contact that sends RPCs to peers over gRPC and leaves the
+// rest to the Application it embeds.
+type Contact[j any, x comparable] struct {
+	raft.Application[j, x]
+
+	// Timeout bounds each attempt at an RPC, and a failed attempt is tried
+	// again up to Retries more times.
+	Timeout time.Duration
+	Retries int
+
+	mutex       sync.Mutex
+	codec       raft.Codec[j]
+	peers       map[uint]string
+	dialOptions []gogrpc.DialOption
+	conns       map[uint]*gogrpc.ClientConn
+}
+
+// NewContact returns a Contact for app that reaches each peer id at the
+// address it maps to. Without dial options connections are made without
+// transport security.
+func NewContact[j any, x comparable](app raft.Application[j, x], peers map[uint]string, options ...gogrpc.DialOption) *Contact[j, x] {
+	if len(options) == 0 {
+		options = []gogrpc.DialOption{gogrpc.WithTransportCredentials(insecure.NewCredentials())}
+	}
+	addresses := make(map[uint]string, len(peers))
+	for id, address := range peers {
+		addresses[id] = address
+	}
+	return &Contact[j, x]{
+		Application: app,
+		Timeout:     defaultTimeout,
+		Retries:     defaultRetries,
+		codec:       raft.JSONCodec[j]{},
+		peers:       addresses,
+		dialOptions: options,
+		conns:       make(map[uint]*gogrpc.ClientConn),
+	}
+}
+
+// UseCodec sets the codec commands are sent with. Every peer has to use the
+// same one.
+func (c *Contact[j, x]) UseCodec(codec raft.Codec[j]) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.codec = codec
+}
+
+func (c *Contact[j, x]) GetPeerIds() []uint {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	ids := make([]uint, 0, len(c.peers))
+	for id := range c.peers {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+func (c *Contact[j, x]) RequestVotes(ctx context.Context, vote raft.RequestVote[j]) map[uint]raft.Reply {
+	var mutex sync.Mutex
+	replies := make(map[uint]raft.Reply)
+	var wg sync.WaitGroup
+	for _, peer := range c.GetPeerIds() {
+		wg.Add(1)
+		peer := peer
+		go func() {
+			defer wg.Done()
+			reply := new(replyMessage)
+			if c.invoke(ctx, peer, "RequestVote", &voteMessage[j]{vote}, reply) != nil {
+				return
+			}
+			mutex.Lock()
+			replies[peer] = reply.Reply
+			mutex.Unlock()
+		}()
+	}
+	wg.Wait()
+	return replies
+}
+
+func (c *Contact[j, x]) AppendEntries(ctx context.Context, entries map[uint]raft.AppendEntries[j]) map[uint]raft.Reply {
+	c.mutex.Lock()
+	codec := c.codec
+	c.mutex.Unlock()
+	var mutex sync.Mutex
+	replies := make(map[uint]raft.Reply, len(entries))
+	var wg sync.WaitGroup
+	for peer, request := range entries {
+		wg.Add(1)
+		peer, request := peer, request
+		go func() {
+			defer wg.Done()
+			reply := new(replyMessage)
+			if c.invoke(ctx, peer, "AppendEntries", &appendMessage[j]{request, codec}, reply) != nil {
+				return
+			}
+			mutex.Lock()
+			replies[peer] = reply.Reply
+			mutex.Unlock()
+		}()
+	}
+	wg.Wait()
+	return replies
+}
+
+func (c *Contact[j, x]) InstallSnapshot(ctx context.Context, peer uint, snapshot raft.InstallSnapshot) raft.Reply {
+	reply := new(replyMessage)
+	if c.invoke(ctx, peer, "InstallSnapshot", &snapshotMessage{snapshot}, reply) != nil {
+		return raft.Reply{}
+	}
+	return reply.Reply
+}
+
+// Close closes every connection opened to a peer.
+func (c *Contact[j, x]) Close() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	var first error
+	for id, conn := range c.conns {
+		if err := conn.Close(); err != nil && first == nil {
+			first = err
+		}
+		delete(c.conns, id)
+	}
+	return first
+}
+
+// invoke calls method on peer, retrying failed attempts until ctx is done.
+func (c *Contact[j, x]) invoke(ctx context.Context, peer uint, method string, request, reply message) error {
+	conn, err := c.conn(peer)
+	if err != nil {
+		return err
+	}
+	for attempt := 0; ; attempt++ {
+		attemptCtx, cancel := context.WithTimeout(ctx, c.Timeout)
+		err = conn.Invoke(attemptCtx, "/"+serviceName+"/"+method, request, reply, gogrpc.CallContentSubtype(codecName))
+		cancel()
+		if err == nil || attempt >= c.Retries || ctx.Err() != nil {
+			return err
+		}
+	}
+}
+
+// conn returns the connection to peer, creating it on first use.
+func (c *Contact[j, x]) conn(peer uint) (*gogrpc.ClientConn, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if conn, ok := c.conns[peer]; ok {
+		return conn, nil
+	}
+	address, ok := c.peers[peer]
+	if !ok {
+		return nil, raft.ErrUnknownPeer
+	}
+	conn, err := gogrpc.NewClient(address, c.dialOptions...)
+	if err != nil {
+		return nil, err
+	}
+	c.conns[peer] = conn
+	return conn, nil
+}
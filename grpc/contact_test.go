@@ -0,0 +1,110 @@
+package grpc
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	gogrpc "google.golang.org/grpc"
+
+	raft "raft-go"
+)
+
+// app is an Application for string commands that accepts every log.
+type app struct{}
+
+func (app) GetLeader() uint                       { return 0 }
+func (app) GetLeaderLog() []raft.LogEntry[string] { return nil }
+func (app) ValidLogEntryCommand(string) bool      { return true }
+func (app) ValidLog([]raft.LogEntry[string]) bool { return true }
+func (app) ExecuteLog(uint, []string) error       { return nil }
+func (app) DefaultLogEntryCommand() string        { return "NEXT" }
+func (app) LogValue([]raft.LogEntry[string]) int  { return 0 }
+
+type module = raft.ConsensusModule[string, int, bool]
+
+// waitFor polls until cond holds, failing the test with what if it does not
+// within five seconds.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestClusterOverLoopback(t *testing.T) {
+	const n = 3
+	listeners := make(map[uint]net.Listener, n)
+	for id := uint(1); id <= n; id++ {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		listeners[id] = listener
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var modules []*module
+	for id := uint(1); id <= n; id++ {
+		peers := make(map[uint]string)
+		for peer, listener := range listeners {
+			if peer != id {
+				peers[peer] = listener.Addr().String()
+			}
+		}
+		contact := NewContact[string, int](app{}, peers)
+		m, err := raft.NewConsensusModule[string, int, bool](id, contact, raft.NewMemoryStorage[string]())
+		if err != nil {
+			t.Fatal(err)
+		}
+		server := gogrpc.NewServer()
+		Register(server, m)
+		go server.Serve(listeners[id])
+		t.Cleanup(func() {
+			m.Close()
+			server.Stop()
+			contact.Close()
+		})
+		go func() {
+			for range m.ReceiveChan {
+			}
+		}()
+		m.Start(ctx)
+		modules = append(modules, m)
+	}
+
+	var leader *module
+	waitFor(t, "a leader", func() bool {
+		for _, m := range modules {
+			if _, isLeader, _ := m.GetState(); isLeader {
+				leader = m
+				return true
+			}
+		}
+		return false
+	})
+	proposeCtx, proposeCancel := context.WithTimeout(ctx, 5*time.Second)
+	defer proposeCancel()
+	index, _, err := leader.ProposeWait(proposeCtx, "SET a 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the entry to commit everywhere", func() bool {
+		for _, m := range modules {
+			if m.GetCommitIndex() < index {
+				return false
+			}
+		}
+		return true
+	})
+	for _, m := range modules {
+		if entry, err := m.Get(index); err != nil || entry.Command != "SET a 1" {
+			t.Errorf("node %d: Get(%d) = %v, %v, want the proposal", m.Id, index, entry, err)
+		}
+	}
+}
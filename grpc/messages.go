@@ -0,0 +1,360 @@
+package grpc
+
+import (
+	"errors"
+	"maps"
+	"slices"
+
+	"google.golang.org/protobuf/encoding/protowire"
+
+	raft "raft-go"
+)
+
+// message is implemented by the wire forms of the messages in raft.proto.
+type message interface {
+	marshal() ([]byte, error)
+	unmarshal(data []byte) error
+}
+
+type voteMessage[j any] struct {
+	raft.RequestVote[j]
+}
+
+type replyMessage struct {
+	raft.Reply
+}
+
+// appendMessage carries the codec its commands are encoded with.
+type appendMessage[j any] struct {
+	raft.AppendEntries[j]
+	codec raft.Codec[j]
+}
+
+type snapshotMessage struct {
+	raft.InstallSnapshot
+}
+
+func (m *voteMessage[j]) marshal() ([]byte, error) {
+	var e encoder
+	e.uint(1, uint64(m.Term))
+	e.uint(2, uint64(m.CandidateId))
+	e.uint(3, uint64(m.LastLogIndex))
+	e.uint(4, uint64(m.LastLogTerm))
+	e.bool(5, m.PreVote)
+	e.bool(6, m.LeadershipTransfer)
+	return e, nil
+}
+
+func (m *voteMessage[j]) unmarshal(data []byte) error {
+	return decode(data, func(num protowire.Number, d *decoder) {
+		switch num {
+		case 1:
+			m.Term = raft.Term(d.uint())
+		case 2:
+			m.CandidateId = uint(d.uint())
+		case 3:
+			m.LastLogIndex = raft.Index(d.uint())
+		case 4:
+			m.LastLogTerm = raft.Term(d.uint())
+		case 5:
+			m.PreVote = d.uint() != 0
+		case 6:
+			m.LeadershipTransfer = d.uint() != 0
+		default:
+			d.skip()
+		}
+	})
+}
+
+func (m *replyMessage) marshal() ([]byte, error) {
+	var e encoder
+	e.uint(1, uint64(m.Term))
+	e.bool(2, m.VoteGranted)
+	e.bool(3, m.Success)
+	e.uint(4, uint64(m.ConflictIndex))
+	e.uint(5, uint64(m.ConflictTerm))
+	return e, nil
+}
+
+func (m *replyMessage) unmarshal(data []byte) error {
+	return decode(data, func(num protowire.Number, d *decoder) {
+		switch num {
+		case 1:
+			m.Term = raft.Term(d.uint())
+		case 2:
+			m.VoteGranted = d.uint() != 0
+		case 3:
+			m.Success = d.uint() != 0
+		case 4:
+			m.ConflictIndex = raft.Index(d.uint())
+		case 5:
+			m.ConflictTerm = raft.Term(d.uint())
+		default:
+			d.skip()
+		}
+	})
+}
+
+func (m *appendMessage[j]) marshal() ([]byte, error) {
+	var e encoder
+	e.uint(1, uint64(m.Term))
+	e.uint(2, uint64(m.LeaderId))
+	e.uint(3, uint64(m.PrevLogIndex))
+	e.uint(4, uint64(m.PrevLogTerm))
+	for _, entry := range m.Entries {
+		command, err := m.codec.Encode(entry.Command)
+		if err != nil {
+			return nil, err
+		}
+		var inner encoder
+		inner.bytes(1, command)
+		inner.uint(2, uint64(entry.Term))
+		inner.uint(3, uint64(entry.Type))
+		inner.uints(4, entry.Configuration)
+		inner.uints(5, entry.Learners)
+		inner.uint(6, uint64(entry.ClientId))
+		inner.uint(7, uint64(entry.Seq))
+		e.message(5, inner)
+	}
+	e.uint(6, uint64(m.LeaderCommit))
+	e.bool(7, m.TimeoutNow)
+	return e, nil
+}
+
+func (m *appendMessage[j]) unmarshal(data []byte) error {
+	m.Entries = []raft.LogEntry[j]{}
+	return decode(data, func(num protowire.Number, d *decoder) {
+		switch num {
+		case 1:
+			m.Term = raft.Term(d.uint())
+		case 2:
+			m.LeaderId = uint(d.uint())
+		case 3:
+			m.PrevLogIndex = raft.Index(d.uint())
+		case 4:
+			m.PrevLogTerm = raft.Term(d.uint())
+		case 5:
+			var entry raft.LogEntry[j]
+			d.fail(decode(d.bytes(), func(num protowire.Number, d *decoder) {
+				switch num {
+				case 1:
+					command, err := m.codec.Decode(d.bytes())
+					entry.Command = command
+					d.fail(err)
+				case 2:
+					entry.Term = raft.Term(d.uint())
+				case 3:
+					entry.Type = raft.LogEntryType(d.uint())
+				case 4:
+					entry.Configuration = d.uints(entry.Configuration)
+				case 5:
+					entry.Learners = d.uints(entry.Learners)
+				case 6:
+					entry.ClientId = uint(d.uint())
+				case 7:
+					entry.Seq = uint(d.uint())
+				default:
+					d.skip()
+				}
+			}))
+			m.Entries = append(m.Entries, entry)
+		case 6:
+			m.LeaderCommit = raft.Index(d.uint())
+		case 7:
+			m.TimeoutNow = d.uint() != 0
+		default:
+			d.skip()
+		}
+	})
+}
+
+func (m *snapshotMessage) marshal() ([]byte, error) {
+	var e encoder
+	e.uint(1, uint64(m.Term))
+	e.uint(2, uint64(m.LeaderId))
+	e.uint(3, uint64(m.LastIncludedIndex))
+	e.uint(4, uint64(m.LastIncludedTerm))
+	e.uints(5, m.Configuration)
+	e.bytes(6, m.Data)
+	e.uints(7, m.Learners)
+	for _, clientId := range slices.Sorted(maps.Keys(m.Sessions)) {
+		session := m.Sessions[clientId]
+		var inner encoder
+		inner.uint(1, uint64(clientId))
+		inner.uint(2, uint64(session.Seq))
+		inner.uint(3, uint64(session.Index))
+		inner.uint(4, uint64(session.Term))
+		e.message(8, inner)
+	}
+	return e, nil
+}
+
+func (m *snapshotMessage) unmarshal(data []byte) error {
+	return decode(data, func(num protowire.Number, d *decoder) {
+		switch num {
+		case 1:
+			m.Term = raft.Term(d.uint())
+		case 2:
+			m.LeaderId = uint(d.uint())
+		case 3:
+			m.LastIncludedIndex = raft.Index(d.uint())
+		case 4:
+			m.LastIncludedTerm = raft.Term(d.uint())
+		case 5:
+			m.Configuration = d.uints(m.Configuration)
+		case 6:
+			m.Data = append([]byte(nil), d.bytes()...)
+		case 7:
+			m.Learners = d.uints(m.Learners)
+		case 8:
+			var clientId uint
+			var session raft.ClientSession
+			d.fail(decode(d.bytes(), func(num protowire.Number, d *decoder) {
+				switch num {
+				case 1:
+					clientId = uint(d.uint())
+				case 2:
+					session.Seq = uint(d.uint())
+				case 3:
+					session.Index = raft.Index(d.uint())
+				case 4:
+					session.Term = raft.Term(d.uint())
+				default:
+					d.skip()
+				}
+			}))
+			if m.Sessions == nil {
+				m.Sessions = make(map[uint]raft.ClientSession)
+			}
+			m.Sessions[clientId] = session
+		default:
+			d.skip()
+		}
+	})
+}
+
+// encoder appends proto3 fields, leaving out zero values.
+type encoder []byte
+
+func (e *encoder) uint(num protowire.Number, value uint64) {
+	if value == 0 {
+		return
+	}
+	*e = protowire.AppendTag(*e, num, protowire.VarintType)
+	*e = protowire.AppendVarint(*e, value)
+}
+
+func (e *encoder) bool(num protowire.Number, value bool) {
+	if value {
+		e.uint(num, 1)
+	}
+}
+
+func (e *encoder) bytes(num protowire.Number, value []byte) {
+	if len(value) == 0 {
+		return
+	}
+	*e = protowire.AppendTag(*e, num, protowire.BytesType)
+	*e = protowire.AppendBytes(*e, value)
+}
+
+// uints writes a packed repeated uint64 field.
+func (e *encoder) uints(num protowire.Number, values []uint) {
+	var packed []byte
+	for _, value := range values {
+		packed = protowire.AppendVarint(packed, uint64(value))
+	}
+	e.bytes(num, packed)
+}
+
+// message writes an embedded message, even when it is empty.
+func (e *encoder) message(num protowire.Number, value []byte) {
+	*e = protowire.AppendTag(*e, num, protowire.BytesType)
+	*e = protowire.AppendBytes(*e, value)
+}
+
+var errWireType = errors.New("raft grpc: unexpected wire type")
+
+// decoder reads the value of the field whose tag was just consumed. The first
+// error it meets is kept and stops decoding.
+type decoder struct {
+	data []byte
+	typ  protowire.Type
+	err  error
+}
+
+func (d *decoder) fail(err error) {
+	if d.err == nil {
+		d.err = err
+	}
+}
+
+func (d *decoder) consume(n int) {
+	if n < 0 {
+		d.fail(protowire.ParseError(n))
+		d.data = nil
+		return
+	}
+	d.data = d.data[n:]
+}
+
+func (d *decoder) uint() uint64 {
+	if d.typ != protowire.VarintType {
+		d.fail(errWireType)
+		d.skip()
+		return 0
+	}
+	value, n := protowire.ConsumeVarint(d.data)
+	d.consume(n)
+	return value
+}
+
+func (d *decoder) bytes() []byte {
+	if d.typ != protowire.BytesType {
+		d.fail(errWireType)
+		d.skip()
+		return nil
+	}
+	value, n := protowire.ConsumeBytes(d.data)
+	d.consume(n)
+	return value
+}
+
+// uints reads a repeated uint64 field in either packed or unpacked form,
+// appending to values.
+func (d *decoder) uints(values []uint) []uint {
+	if d.typ == protowire.VarintType {
+		return append(values, uint(d.uint()))
+	}
+	packed := d.bytes()
+	for len(packed) > 0 {
+		value, n := protowire.ConsumeVarint(packed)
+		if n < 0 {
+			d.fail(protowire.ParseError(n))
+			return values
+		}
+		values = append(values, uint(value))
+		packed = packed[n:]
+	}
+	return values
+}
+
+func (d *decoder) skip() {
+	d.consume(protowire.ConsumeFieldValue(0, d.typ, d.data))
+}
+
+// decode calls field for every field in data, which must read or skip the
+// field's value.
+func decode(data []byte, field func(num protowire.Number, d *decoder)) error {
+	d := &decoder{data: data}
+	for len(d.data) > 0 && d.err == nil {
+		num, typ, n := protowire.ConsumeTag(d.data)
+		d.consume(n)
+		if d.err != nil {
+			break
+		}
+		d.typ = typ
+		field(num, d)
+	}
+	return d.err
+}
@@ -0,0 +1,78 @@
+// Package grpc carries Raft RPCs between modules over gRPC. Register serves a
+// module's handlers on a grpc.Server and Contact reaches the rest of the
+// cluster by dialing each peer's address.
+package grpc
+
+import (
+	"context"
+
+	gogrpc "google.golang.org/grpc"
+
+	raft "raft-go"
+)
+
+const serviceName = "raft.Raft"
+
+// Register serves module's Vote, AppendEntry and InstallSnapshot handlers on
+// server as the Raft service from raft.proto, decoding commands with the
+// module's Codec.
+func Register[j any, x comparable, k any](server *gogrpc.Server, module *raft.ConsensusModule[j, x, k]) {
+	server.RegisterService(serviceDesc[j, x, k](module.Codec), module)
+}
+
+func serviceDesc[j any, x comparable, k any](codec raft.Codec[j]) *gogrpc.ServiceDesc {
+	return &gogrpc.ServiceDesc{
+		ServiceName: serviceName,
+		HandlerType: (*any)(nil),
+		Methods: []gogrpc.MethodDesc{
+			{
+				MethodName: "RequestVote",
+				Handler: handler("RequestVote", newMessage[voteMessage[j]], func(module *raft.ConsensusModule[j, x, k], request *voteMessage[j]) raft.Reply {
+					return module.Vote(request.RequestVote)
+				}),
+			},
+			{
+				MethodName: "AppendEntries",
+				Handler: handler("AppendEntries", func() *appendMessage[j] {
+					return &appendMessage[j]{codec: codec}
+				}, func(module *raft.ConsensusModule[j, x, k], request *appendMessage[j]) raft.Reply {
+					return module.AppendEntry(request.AppendEntries)
+				}),
+			},
+			{
+				MethodName: "InstallSnapshot",
+				Handler: handler("InstallSnapshot", newMessage[snapshotMessage], func(module *raft.ConsensusModule[j, x, k], request *snapshotMessage) raft.Reply {
+					return module.InstallSnapshot(request.InstallSnapshot)
+				}),
+			},
+		},
+		Metadata: "raft.proto",
+	}
+}
+
+// newMessage returns an empty message of type R to decode a request into.
+func newMessage[R any]() *R {
+	return new(R)
+}
+
+// handler adapts call into the unary handler for method. It decodes a
+// request made by newRequest, runs it through any interceptor and answers
+// with the module's Reply.
+func handler[M any, P message](method string, newRequest func() P, call func(module M, request P) raft.Reply) func(any, context.Context, func(any) error, gogrpc.UnaryServerInterceptor) (any, error) {
+	return func(srv any, ctx context.Context, dec func(any) error, interceptor gogrpc.UnaryServerInterceptor) (any, error) {
+		request := newRequest()
+		if err := dec(request); err != nil {
+			return nil, err
+		}
+		handle := func(ctx context.Context, request any) (any, error) {
+			return &replyMessage{call(srv.(M), request.(P))}, nil
+		}
+		if interceptor == nil {
+			return handle(ctx, request)
+		}
+		return interceptor(ctx, request, &gogrpc.UnaryServerInfo{
+			Server:     srv,
+			FullMethod: "/" + serviceName + "/" + method,
+		}, handle)
+	}
+}
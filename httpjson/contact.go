@@ -0,0 +1,152 @@
+package httpjson
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	raft "raft-go"
+)
+
+const defaultTimeout = 100 * time.Millisecond
+
+// Contact is a raft.Contact that POSTs RPCs to each peer's base URL and
+// leaves the rest to the Application it embeds.
+type Contact[j any, x comparable] struct {
+	raft.Application[j, x]
+
+	// Client sends the requests, each bounded by Timeout as well as the
+	// context of the call.
+	Client  *http.Client
+	Timeout time.Duration
+
+	mutex sync.Mutex
+	codec raft.Codec[j]
+	peers map[uint]string
+}
+
+// NewContact returns a Contact for app that reaches each peer id at the base
+// URL it maps to, such as "http://10.0.0.2:8080".
+func NewContact[j any, x comparable](app raft.Application[j, x], peers map[uint]string) *Contact[j, x] {
+	urls := make(map[uint]string, len(peers))
+	for id, url := range peers {
+		urls[id] = strings.TrimSuffix(url, "/")
+	}
+	return &Contact[j, x]{
+		Application: app,
+		Client:      http.DefaultClient,
+		Timeout:     defaultTimeout,
+		codec:       raft.JSONCodec[j]{},
+		peers:       urls,
+	}
+}
+
+// UseCodec sets the codec commands are sent with. Every peer has to use the
+// same one.
+func (c *Contact[j, x]) UseCodec(codec raft.Codec[j]) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.codec = codec
+}
+
+func (c *Contact[j, x]) GetPeerIds() []uint {
+	ids := make([]uint, 0, len(c.peers))
+	for id := range c.peers {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+func (c *Contact[j, x]) RequestVotes(ctx context.Context, vote raft.RequestVote[j]) map[uint]raft.Reply {
+	var mutex sync.Mutex
+	replies := make(map[uint]raft.Reply)
+	var wg sync.WaitGroup
+	for _, peer := range c.GetPeerIds() {
+		wg.Add(1)
+		peer := peer
+		go func() {
+			defer wg.Done()
+			reply, err := c.post(ctx, peer, RequestVotePath, vote)
+			if err != nil {
+				return
+			}
+			mutex.Lock()
+			replies[peer] = reply
+			mutex.Unlock()
+		}()
+	}
+	wg.Wait()
+	return replies
+}
+
+func (c *Contact[j, x]) AppendEntries(ctx context.Context, entries map[uint]raft.AppendEntries[j]) map[uint]raft.Reply {
+	c.mutex.Lock()
+	codec := c.codec
+	c.mutex.Unlock()
+	var mutex sync.Mutex
+	replies := make(map[uint]raft.Reply, len(entries))
+	var wg sync.WaitGroup
+	for peer, request := range entries {
+		wg.Add(1)
+		peer, request := peer, request
+		go func() {
+			defer wg.Done()
+			wire, err := encodeAppend(codec, request)
+			if err != nil {
+				return
+			}
+			reply, err := c.post(ctx, peer, AppendEntriesPath, wire)
+			if err != nil {
+				return
+			}
+			mutex.Lock()
+			replies[peer] = reply
+			mutex.Unlock()
+		}()
+	}
+	wg.Wait()
+	return replies
+}
+
+func (c *Contact[j, x]) InstallSnapshot(ctx context.Context, peer uint, snapshot raft.InstallSnapshot) raft.Reply {
+	reply, _ := c.post(ctx, peer, InstallSnapshotPath, snapshot)
+	return reply
+}
+
+// post sends request to path on peer and decodes the Reply, giving up after
+// Timeout or once ctx is done.
+func (c *Contact[j, x]) post(ctx context.Context, peer uint, path string, request any) (raft.Reply, error) {
+	url, ok := c.peers[peer]
+	if !ok {
+		return raft.Reply{}, raft.ErrUnknownPeer
+	}
+	body, err := json.Marshal(request)
+	if err != nil {
+		return raft.Reply{}, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, c.Timeout)
+	defer cancel()
+	httpRequest, err := http.NewRequestWithContext(ctx, http.MethodPost, url+path, bytes.NewReader(body))
+	if err != nil {
+		return raft.Reply{}, err
+	}
+	httpRequest.Header.Set("Content-Type", "application/json")
+	response, err := c.Client.Do(httpRequest)
+	if err != nil {
+		return raft.Reply{}, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return raft.Reply{}, fmt.Errorf("raft http: %s from peer %d", response.Status, peer)
+	}
+	var reply raft.Reply
+	err = json.NewDecoder(response.Body).Decode(&reply)
+	return reply, err
+}
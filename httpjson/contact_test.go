@@ -0,0 +1,131 @@
+package httpjson
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	raft "raft-go"
+)
+
+// app is an Application for string commands that accepts every log.
+type app struct{}
+
+func (app) GetLeader() uint                       { return 0 }
+func (app) GetLeaderLog() []raft.LogEntry[string] { return nil }
+func (app) ValidLogEntryCommand(string) bool      { return true }
+func (app) ValidLog([]raft.LogEntry[string]) bool { return true }
+func (app) ExecuteLog(uint, []string) error       { return nil }
+func (app) DefaultLogEntryCommand() string        { return "NEXT" }
+func (app) LogValue([]raft.LogEntry[string]) int  { return 0 }
+
+func TestUseCodecWhileSending(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"Term":1,"Success":true}`))
+	}))
+	defer server.Close()
+	contact := NewContact[string, int](app{}, map[uint]string{2: server.URL})
+	request := map[uint]raft.AppendEntries[string]{2: {
+		Term:    1,
+		Entries: []raft.LogEntry[string]{{Term: 1, Command: "SET 1"}},
+	}}
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 20; i++ {
+			contact.UseCodec(raft.JSONCodec[string]{})
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 20; i++ {
+			if reply := contact.AppendEntries(context.Background(), request); !reply[2].Success {
+				t.Errorf("AppendEntries = %v, want success from peer 2", reply)
+			}
+		}
+	}()
+	wg.Wait()
+}
+
+func TestClusterOverHTTP(t *testing.T) {
+	const n = 3
+	muxes := make(map[uint]*http.ServeMux, n)
+	urls := make(map[uint]string, n)
+	for id := uint(1); id <= n; id++ {
+		muxes[id] = http.NewServeMux()
+		server := httptest.NewServer(muxes[id])
+		t.Cleanup(server.Close)
+		urls[id] = server.URL
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var modules []*raft.ConsensusModule[string, int, bool]
+	for id := uint(1); id <= n; id++ {
+		peers := make(map[uint]string)
+		for peer, url := range urls {
+			if peer != id {
+				peers[peer] = url
+			}
+		}
+		module, err := raft.NewConsensusModule[string, int, bool](id, NewContact[string, int](app{}, peers), raft.NewMemoryStorage[string]())
+		if err != nil {
+			t.Fatal(err)
+		}
+		Register(muxes[id], module)
+		t.Cleanup(module.Close)
+		go func(module *raft.ConsensusModule[string, int, bool]) {
+			for range module.ReceiveChan {
+			}
+		}(module)
+		module.Start(ctx)
+		modules = append(modules, module)
+	}
+
+	var leader *raft.ConsensusModule[string, int, bool]
+	waitFor(t, "a leader", func() bool {
+		for _, module := range modules {
+			if _, isLeader, _ := module.GetState(); isLeader {
+				leader = module
+				return true
+			}
+		}
+		return false
+	})
+	proposeCtx, proposeCancel := context.WithTimeout(ctx, 5*time.Second)
+	defer proposeCancel()
+	index, _, err := leader.ProposeWait(proposeCtx, "SET a 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the entry to commit everywhere", func() bool {
+		for _, module := range modules {
+			if module.GetCommitIndex() < index {
+				return false
+			}
+		}
+		return true
+	})
+	for _, module := range modules {
+		if entry, err := module.Get(index); err != nil || entry.Command != "SET a 1" {
+			t.Errorf("node %d: Get(%d) = %v, %v, want the proposal", module.Id, index, entry, err)
+		}
+	}
+}
+
+// waitFor polls until cond holds, failing the test with what if it does not
+// within five seconds.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
@@ -0,0 +1,81 @@
+package httpjson
+
+import raft "raft-go"
+
+// appendRequest is the wire form of an AppendEntries. Its commands are
+// encoded with the module's Codec, so any command type can be sent.
+type appendRequest struct {
+	Term         raft.Term
+	LeaderId     uint
+	PrevLogIndex raft.Index
+	PrevLogTerm  raft.Term
+	Entries      []entry
+	LeaderCommit raft.Index
+	TimeoutNow   bool
+}
+
+type entry struct {
+	Command       []byte
+	Term          raft.Term
+	Type          raft.LogEntryType
+	Configuration []uint
+	Learners      []uint
+	ClientId      uint
+	Seq           uint
+}
+
+func encodeAppend[j any](codec raft.Codec[j], request raft.AppendEntries[j]) (appendRequest, error) {
+	wire := appendRequest{
+		Term:         request.Term,
+		LeaderId:     request.LeaderId,
+		PrevLogIndex: request.PrevLogIndex,
+		PrevLogTerm:  request.PrevLogTerm,
+		Entries:      make([]entry, 0, len(request.Entries)),
+		LeaderCommit: request.LeaderCommit,
+		TimeoutNow:   request.TimeoutNow,
+	}
+	for _, e := range request.Entries {
+		command, err := codec.Encode(e.Command)
+		if err != nil {
+			return appendRequest{}, err
+		}
+		wire.Entries = append(wire.Entries, entry{
+			Command:       command,
+			Term:          e.Term,
+			Type:          e.Type,
+			Configuration: e.Configuration,
+			Learners:      e.Learners,
+			ClientId:      e.ClientId,
+			Seq:           e.Seq,
+		})
+	}
+	return wire, nil
+}
+
+func decodeAppend[j any](codec raft.Codec[j], wire appendRequest) (raft.AppendEntries[j], error) {
+	request := raft.AppendEntries[j]{
+		Term:         wire.Term,
+		LeaderId:     wire.LeaderId,
+		PrevLogIndex: wire.PrevLogIndex,
+		PrevLogTerm:  wire.PrevLogTerm,
+		Entries:      make([]raft.LogEntry[j], 0, len(wire.Entries)),
+		LeaderCommit: wire.LeaderCommit,
+		TimeoutNow:   wire.TimeoutNow,
+	}
+	for _, e := range wire.Entries {
+		command, err := codec.Decode(e.Command)
+		if err != nil {
+			return raft.AppendEntries[j]{}, err
+		}
+		request.Entries = append(request.Entries, raft.LogEntry[j]{
+			Command:       command,
+			Term:          e.Term,
+			Type:          e.Type,
+			Configuration: e.Configuration,
+			Learners:      e.Learners,
+			ClientId:      e.ClientId,
+			Seq:           e.Seq,
+		})
+	}
+	return request, nil
+}
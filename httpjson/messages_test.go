@@ -0,0 +1,66 @@
+package httpjson
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	raft "raft-go"
+)
+
+// order is a command with more structure than a string.
+type order struct {
+	Id    int
+	Items map[string]int
+}
+
+// gobCodec encodes commands with encoding/gob, so that nothing depends on
+// them being JSON.
+type gobCodec[j any] struct{}
+
+func (gobCodec[j]) Encode(command j) ([]byte, error) {
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(command)
+	return buf.Bytes(), err
+}
+
+func (gobCodec[j]) Decode(data []byte) (j, error) {
+	var command j
+	err := gob.NewDecoder(bytes.NewReader(data)).Decode(&command)
+	return command, err
+}
+
+func TestAppendRoundTripsStructCommands(t *testing.T) {
+	request := raft.AppendEntries[order]{
+		Term:         3,
+		LeaderId:     2,
+		PrevLogIndex: 4,
+		PrevLogTerm:  2,
+		Entries: []raft.LogEntry[order]{
+			{Term: 3, Command: order{Id: 7, Items: map[string]int{"apple": 2}}},
+			{Term: 3, Command: order{Id: 8, Items: map[string]int{"pear": 1, "fig": 4}}, ClientId: 9, Seq: 1},
+		},
+		LeaderCommit: 4,
+	}
+	wire, err := encodeAppend[order](gobCodec[order]{}, request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := json.Marshal(wire)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var received appendRequest
+	if err := json.Unmarshal(body, &received); err != nil {
+		t.Fatal(err)
+	}
+	got, err := decodeAppend[order](gobCodec[order]{}, received)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, request) {
+		t.Errorf("decoded %+v, want %+v", got, request)
+	}
+}
@@ -0,0 +1,63 @@
+// Package httpjson carries Raft RPCs between modules as JSON over HTTP. Each
+// RPC is a POST of the request to a peer, answered with a JSON Reply. The
+// commands inside an AppendEntries are encoded with the module's Codec.
+package httpjson
+
+import (
+	"encoding/json"
+	"net/http"
+
+	raft "raft-go"
+)
+
+// Paths the handlers are mounted at, relative to a peer's base URL.
+const (
+	RequestVotePath     = "/raft/request-vote"
+	AppendEntriesPath   = "/raft/append-entries"
+	InstallSnapshotPath = "/raft/install-snapshot"
+)
+
+// Register mounts module's Vote, AppendEntry and InstallSnapshot handlers on
+// mux, decoding commands with the module's Codec.
+func Register[j any, x comparable, k any](mux *http.ServeMux, module *raft.ConsensusModule[j, x, k]) {
+	mux.Handle(RequestVotePath, handler(infallible(module.Vote)))
+	mux.Handle(AppendEntriesPath, handler(func(wire appendRequest) (raft.Reply, error) {
+		request, err := decodeAppend(module.Codec, wire)
+		if err != nil {
+			return raft.Reply{}, err
+		}
+		return module.AppendEntry(request), nil
+	}))
+	mux.Handle(InstallSnapshotPath, handler(infallible(module.InstallSnapshot)))
+}
+
+// infallible adapts a handler that cannot reject its request.
+func infallible[R any](call func(R) raft.Reply) func(R) (raft.Reply, error) {
+	return func(request R) (raft.Reply, error) {
+		return call(request), nil
+	}
+}
+
+// handler decodes a POSTed request of type R, passes it to call and writes
+// back the Reply. A request that fails to decode is a bad request.
+func handler[R any](call func(R) (raft.Reply, error)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		var request R
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		reply, err := call(request)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(reply)
+	})
+}
@@ -0,0 +1,139 @@
+// Package rafttest helps test code built on raft-go. Its InvariantChecker
+// verifies the Raft safety properties across the modules of a simulated
+// cluster, such as one from raft.NewCluster.
+package rafttest
+
+import (
+	"errors"
+	"fmt"
+
+	raft "raft-go"
+)
+
+// ErrInvariant is wrapped by every violation Check reports.
+var ErrInvariant = errors.New("rafttest: safety invariant violated")
+
+// InvariantChecker verifies the Raft safety properties across the modules of
+// a cluster under test. It remembers the leader of every term and the term of
+// every committed entry it has seen, so calling Check after each partition
+// and recovery also catches a change between calls. The zero value is ready
+// to use.
+type InvariantChecker[j any, x comparable, k any] struct {
+	leaders   map[raft.Term]uint
+	committed map[raft.Index]raft.Term
+}
+
+// logView is the part of a module's state the checker compares, copied under
+// its mutex: the term and type of every index from first, the snapshot's last
+// index, through the last entry.
+type logView struct {
+	id     uint
+	first  raft.Index
+	terms  []raft.Term
+	types  []raft.LogEntryType
+	commit raft.Index
+}
+
+// termAt returns the term at index and whether the view still holds it.
+func (v logView) termAt(index raft.Index) (raft.Term, bool) {
+	if index < v.first || index >= v.first+raft.Index(len(v.terms)) {
+		return 0, false
+	}
+	return v.terms[index-v.first], true
+}
+
+// CheckInvariants runs a fresh InvariantChecker over modules once.
+func CheckInvariants[j any, x comparable, k any](modules ...*raft.ConsensusModule[j, x, k]) error {
+	var checker InvariantChecker[j, x, k]
+	return checker.Check(modules...)
+}
+
+// Check reports the first violation it finds among modules, wrapping
+// ErrInvariant:
+//
+//   - no term has two leaders;
+//   - two logs holding an entry with the same index and term agree on every
+//     entry before it, and on that entry's type;
+//   - an entry committed anywhere is committed in the same term everywhere,
+//     and stays so between calls.
+func (i *InvariantChecker[j, x, k]) Check(modules ...*raft.ConsensusModule[j, x, k]) error {
+	if i.leaders == nil {
+		i.leaders = make(map[raft.Term]uint)
+		i.committed = make(map[raft.Index]raft.Term)
+	}
+	views := make([]logView, 0, len(modules))
+	for _, module := range modules {
+		view, leader, term := viewOf(module)
+		if leader {
+			if other, ok := i.leaders[term]; ok && other != module.Id {
+				return fmt.Errorf("%w: nodes %d and %d both led term %d", ErrInvariant, other, module.Id, term)
+			}
+			i.leaders[term] = module.Id
+		}
+		views = append(views, view)
+	}
+	for _, view := range views {
+		for index := view.first; index <= view.commit; index++ {
+			term, ok := view.termAt(index)
+			if !ok {
+				continue
+			}
+			if seen, ok := i.committed[index]; ok && seen != term {
+				return fmt.Errorf("%w: node %d has term %d committed at index %d, which was committed in term %d", ErrInvariant, view.id, term, index, seen)
+			}
+			i.committed[index] = term
+		}
+	}
+	for a := range views {
+		for b := a + 1; b < len(views); b++ {
+			if err := logsMatch(views[a], views[b]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// viewOf copies what the checker needs from module under its mutex.
+func viewOf[j any, x comparable, k any](module *raft.ConsensusModule[j, x, k]) (logView, bool, raft.Term) {
+	module.Mutex.Lock()
+	defer module.Mutex.Unlock()
+	view := logView{
+		id:     module.Id,
+		first:  module.LastIncludedIndex,
+		terms:  []raft.Term{module.LastIncludedTerm},
+		types:  []raft.LogEntryType{raft.CommandEntry},
+		commit: module.CommitIndex,
+	}
+	for _, entry := range module.Log {
+		view.terms = append(view.terms, entry.Term)
+		view.types = append(view.types, entry.Type)
+	}
+	return view, module.State == raft.Leader, module.CurrentTerm
+}
+
+// logsMatch checks the Log Matching Property between a and b over the indices
+// both still hold: once they agree on an index they must agree on every one
+// before it, so no agreement may follow a disagreement.
+func logsMatch(a, b logView) error {
+	diverged := raft.Index(0)
+	for index := max(a.first, b.first); ; index++ {
+		termA, okA := a.termAt(index)
+		termB, okB := b.termAt(index)
+		if !okA || !okB {
+			return nil
+		}
+		if termA != termB {
+			if diverged == 0 {
+				diverged = index
+			}
+			continue
+		}
+		if diverged != 0 {
+			return fmt.Errorf("%w: nodes %d and %d agree on index %d in term %d but not on index %d", ErrInvariant, a.id, b.id, index, termA, diverged)
+		}
+		if index > max(a.first, b.first) && a.types[index-a.first] != b.types[index-b.first] {
+			return fmt.Errorf("%w: nodes %d and %d hold entries of different types at index %d in term %d", ErrInvariant, a.id, b.id, index, termA)
+		}
+	}
+}